@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// cpuMaxPeriod is the default cpu.max period in microseconds
+const cpuMaxPeriod = 100000
+
+// CgroupConfig configures cgroup v2 limits in a preset (only for Linux)
+type CgroupConfig struct {
+	// MemoryMax is the memory limit of the whole process tree, e.g. "4G"
+	MemoryMax string `yaml:"memory-max"`
+	// PidsMax is the maximum number of processes in the process tree
+	PidsMax string `yaml:"pids-max"`
+	// CPUMax is the CPU bandwidth limit, either as a percentage of one CPU such as "200%"
+	// or in the cpu.max format "$QUOTA $PERIOD"
+	CPUMax string `yaml:"cpu-max"`
+	// IOMax are lines in the io.max format, e.g. "8:0 rbps=1048576 wbps=1048576"
+	IOMax []string `yaml:"io-max"`
+}
+
+// CgroupLimits are limits applied to the cgroup of the command
+// A nil field leaves the limit unset
+type CgroupLimits struct {
+	// MemoryMax is the memory limit in bytes
+	MemoryMax *uint64
+	// PidsMax is the maximum number of processes
+	PidsMax *uint64
+	// CPUMax is the CPU bandwidth limit
+	CPUMax *CPUMax
+	// IOMax are io.max lines
+	IOMax []string
+}
+
+// CPUMax is a CPU bandwidth limit of Quota microseconds per Period microseconds
+type CPUMax struct {
+	Quota  uint64
+	Period uint64
+}
+
+// String formats the limit in the cpu.max format
+func (c CPUMax) String() string {
+	return fmt.Sprintf("%d %d", c.Quota, c.Period)
+}
+
+// IsEmpty reports whether no cgroup option is configured
+func (c CgroupConfig) IsEmpty() bool {
+	return c.MemoryMax == "" && c.PidsMax == "" && c.CPUMax == "" && len(c.IOMax) == 0
+}
+
+// Parse converts the configured values to cgroup limits
+// The value "max" leaves a limit unset
+func (c CgroupConfig) Parse() (CgroupLimits, error) {
+	var limits CgroupLimits
+	var err error
+	if limits.MemoryMax, err = parseCgroupLimit("memory-max", c.MemoryMax, parseSize); err != nil {
+		return CgroupLimits{}, err
+	}
+	if limits.PidsMax, err = parseCgroupLimit("pids-max", c.PidsMax, parseCount); err != nil {
+		return CgroupLimits{}, err
+	}
+	if value := strings.TrimSpace(c.CPUMax); value != "" && value != "max" {
+		cpuMax, err := parseCPUMax(value)
+		if err != nil {
+			return CgroupLimits{}, fmt.Errorf("invalid cpu-max %q: %w", c.CPUMax, err)
+		}
+		limits.CPUMax = &cpuMax
+	}
+	for _, line := range c.IOMax {
+		line = strings.TrimSpace(line)
+		if len(strings.Fields(line)) < 2 {
+			return CgroupLimits{}, fmt.Errorf("invalid io-max %q: expected \"$MAJ:$MIN $KEY=$VALUE...\"", line)
+		}
+		limits.IOMax = append(limits.IOMax, line)
+	}
+	return limits, nil
+}
+
+// parseCgroupLimit parses a single limit value, returning nil if it is not set or "max"
+func parseCgroupLimit(name, value string, parse func(string) (uint64, error)) (*uint64, error) {
+	if strings.TrimSpace(value) == "max" {
+		return nil, nil
+	}
+	return parseLimit(name, value, parse)
+}
+
+// parseCPUMax parses a percentage of one CPU or a cpu.max value
+func parseCPUMax(value string) (CPUMax, error) {
+	if percent, ok := strings.CutSuffix(value, "%"); ok {
+		n, err := strconv.ParseUint(strings.TrimSpace(percent), 10, 64)
+		if err != nil || n == 0 {
+			return CPUMax{}, fmt.Errorf("expected a positive percentage such as 50%%")
+		}
+		return CPUMax{Quota: n * cpuMaxPeriod / 100, Period: cpuMaxPeriod}, nil
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return CPUMax{}, fmt.Errorf("expected a percentage or \"$QUOTA $PERIOD\"")
+	}
+	quota, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil || quota == 0 {
+		return CPUMax{}, fmt.Errorf("invalid quota %q", fields[0])
+	}
+	period := uint64(cpuMaxPeriod)
+	if len(fields) == 2 {
+		period, err = strconv.ParseUint(fields[1], 10, 64)
+		if err != nil || period == 0 {
+			return CPUMax{}, fmt.Errorf("invalid period %q", fields[1])
+		}
+	}
+	return CPUMax{Quota: quota, Period: period}, nil
+}
+
+// Min returns the lower of the two values for each limit
+// io.max lines are combined, and later lines for the same device take precedence
+func (c CgroupLimits) Min(other CgroupLimits) CgroupLimits {
+	result := CgroupLimits{
+		MemoryMax: minLimit(c.MemoryMax, other.MemoryMax),
+		PidsMax:   minLimit(c.PidsMax, other.PidsMax),
+		CPUMax:    c.CPUMax,
+		IOMax:     append(append([]string(nil), c.IOMax...), other.IOMax...),
+	}
+	if result.CPUMax == nil || (other.CPUMax != nil &&
+		other.CPUMax.Quota*result.CPUMax.Period < result.CPUMax.Quota*other.CPUMax.Period) {
+		result.CPUMax = other.CPUMax
+	}
+	return result
+}
+
+// IsSet reports whether any limit is set
+func (c CgroupLimits) IsSet() bool {
+	return c.MemoryMax != nil || c.PidsMax != nil || c.CPUMax != nil || len(c.IOMax) > 0
+}
@@ -0,0 +1,327 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// cgroupKillTimeout is how long cage waits for the processes of a cgroup to exit after killing them
+const cgroupKillTimeout = 5 * time.Second
+
+// cgroup is a cgroup v2 created for the command
+type cgroup struct {
+	path string
+	dir  *os.File
+}
+
+// createCgroup creates a cgroup for the command and applies the limits to it
+// The cgroup is created under the user's systemd app.slice, which is delegated to the user,
+// or next to the cgroup of cage otherwise
+func createCgroup(limits CgroupLimits) (*cgroup, error) {
+	mountpoint, err := readCgroup2Mountpoint()
+	if err != nil {
+		return nil, err
+	}
+	current, err := readCurrentCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	parent, err := cgroupParent(mountpoint, current)
+	if err != nil {
+		return nil, err
+	}
+
+	// Controllers must be enabled in the parent to set limits in the child
+	// The memory controller is also needed to report peak memory usage
+	controllers := []string{"memory"}
+	if limits.PidsMax != nil {
+		controllers = append(controllers, "pids")
+	}
+	if limits.CPUMax != nil {
+		controllers = append(controllers, "cpu")
+	}
+	if len(limits.IOMax) > 0 {
+		controllers = append(controllers, "io")
+	}
+	for _, controller := range controllers {
+		err := writeCgroupFile(parent, "cgroup.subtree_control", "+"+controller)
+		if err != nil && (controller != "memory" || limits.MemoryMax != nil) {
+			return nil, fmt.Errorf("enable %s controller in %s: %w", controller, parent, err)
+		}
+	}
+
+	path := filepath.Join(parent, fmt.Sprintf("cage-%d", os.Getpid()))
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return nil, fmt.Errorf("create cgroup: %w", err)
+	}
+	cg := &cgroup{path: path}
+
+	if err := cg.setLimits(limits); err != nil {
+		cg.remove()
+		return nil, err
+	}
+
+	cg.dir, err = os.Open(path)
+	if err != nil {
+		cg.remove()
+		return nil, fmt.Errorf("open cgroup: %w", err)
+	}
+	return cg, nil
+}
+
+// setLimits writes the limits to the cgroup interface files
+func (cg *cgroup) setLimits(limits CgroupLimits) error {
+	if limits.MemoryMax != nil {
+		if err := writeCgroupFile(cg.path, "memory.max", strconv.FormatUint(*limits.MemoryMax, 10)); err != nil {
+			return fmt.Errorf("set memory.max: %w", err)
+		}
+		// Do not let the command escape the limit by swapping
+		_ = writeCgroupFile(cg.path, "memory.swap.max", "0")
+	}
+	if limits.PidsMax != nil {
+		if err := writeCgroupFile(cg.path, "pids.max", strconv.FormatUint(*limits.PidsMax, 10)); err != nil {
+			return fmt.Errorf("set pids.max: %w", err)
+		}
+	}
+	if limits.CPUMax != nil {
+		if err := writeCgroupFile(cg.path, "cpu.max", limits.CPUMax.String()); err != nil {
+			return fmt.Errorf("set cpu.max: %w", err)
+		}
+	}
+	for _, line := range limits.IOMax {
+		if err := writeCgroupFile(cg.path, "io.max", line); err != nil {
+			return fmt.Errorf("set io.max %q: %w", line, err)
+		}
+	}
+	return nil
+}
+
+// report prints the peak memory and CPU usage of the cgroup
+func (cg *cgroup) report(w io.Writer) {
+	var parts []string
+	if peak, err := os.ReadFile(filepath.Join(cg.path, "memory.peak")); err == nil {
+		if bytes, err := strconv.ParseUint(strings.TrimSpace(string(peak)), 10, 64); err == nil {
+			parts = append(parts, fmt.Sprintf("peak memory %s", formatBytes(bytes)))
+		}
+	}
+	if stat, err := readCgroupStat(filepath.Join(cg.path, "cpu.stat")); err == nil {
+		parts = append(parts, fmt.Sprintf(
+			"CPU time %s (user %s, system %s)",
+			formatMicroseconds(stat["usage_usec"]),
+			formatMicroseconds(stat["user_usec"]),
+			formatMicroseconds(stat["system_usec"]),
+		))
+	}
+	if len(parts) > 0 {
+		fmt.Fprintf(w, "cage: %s\n", strings.Join(parts, ", "))
+	}
+}
+
+// kill kills all processes in the cgroup and waits until they have exited
+// cgroup.kill needs Linux 5.14, so the processes in cgroup.procs are killed one by one on older kernels
+func (cg *cgroup) kill() error {
+	if err := writeCgroupFile(cg.path, "cgroup.kill", "1"); err != nil {
+		if err := cg.killProcs(); err != nil {
+			return err
+		}
+	}
+
+	deadline := time.Now().Add(cgroupKillTimeout)
+	for {
+		populated, err := cg.populated()
+		if err != nil {
+			return err
+		}
+		if !populated {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("processes in %s did not exit within %s", cg.path, cgroupKillTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// killProcs kills the processes in cgroup.procs until none are left
+// Processes started while the others are killed are found in the next round
+func (cg *cgroup) killProcs() error {
+	deadline := time.Now().Add(cgroupKillTimeout)
+	for time.Now().Before(deadline) {
+		data, err := os.ReadFile(filepath.Join(cg.path, "cgroup.procs"))
+		if err != nil {
+			return fmt.Errorf("read cgroup.procs: %w", err)
+		}
+		pids := strings.Fields(string(data))
+		if len(pids) == 0 {
+			return nil
+		}
+		for _, pid := range pids {
+			if n, err := strconv.Atoi(pid); err == nil {
+				_ = unix.Kill(n, unix.SIGKILL)
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// populated reports whether any process is left in the cgroup, as shown by cgroup.events
+func (cg *cgroup) populated() (bool, error) {
+	stat, err := readCgroupStat(filepath.Join(cg.path, "cgroup.events"))
+	if err != nil {
+		return false, fmt.Errorf("read cgroup.events: %w", err)
+	}
+	return stat["populated"] != 0, nil
+}
+
+// remove deletes the cgroup
+// It fails if processes of the command are still running, so they must be killed first
+func (cg *cgroup) remove() error {
+	if cg.dir != nil {
+		cg.dir.Close()
+	}
+	return os.Remove(cg.path)
+}
+
+// readCgroup2Mountpoint returns where the cgroup v2 hierarchy is mounted
+func readCgroup2Mountpoint() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	mountpoint, ok := findCgroup2Mountpoint(f)
+	if !ok {
+		return "", errors.New("cgroup v2 is not mounted")
+	}
+	return mountpoint, nil
+}
+
+// findCgroup2Mountpoint returns the first cgroup2 mount point in mountinfo
+func findCgroup2Mountpoint(mountinfo io.Reader) (string, bool) {
+	scanner := bufio.NewScanner(mountinfo)
+	for scanner.Scan() {
+		// Optional fields are terminated by a single "-",
+		// which is followed by the filesystem type
+		before, after, ok := strings.Cut(scanner.Text(), " - ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(before)
+		fsType := strings.Fields(after)
+		if len(fields) >= 5 && len(fsType) > 0 && fsType[0] == "cgroup2" {
+			return fields[4], true
+		}
+	}
+	return "", false
+}
+
+// readCurrentCgroup returns the cgroup v2 path of the current process
+func readCurrentCgroup() (string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	path, ok := findCgroup2Path(f)
+	if !ok {
+		return "", errors.New("the current process is not in a cgroup v2 hierarchy")
+	}
+	return path, nil
+}
+
+// findCgroup2Path returns the cgroup v2 path in the contents of /proc/self/cgroup
+func findCgroup2Path(procCgroup io.Reader) (string, bool) {
+	scanner := bufio.NewScanner(procCgroup)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// cgroupParent returns a writable cgroup to create the command's cgroup in
+func cgroupParent(mountpoint, current string) (string, error) {
+	uid := os.Getuid()
+	candidates := []string{
+		filepath.Join(
+			mountpoint,
+			"user.slice",
+			fmt.Sprintf("user-%d.slice", uid),
+			fmt.Sprintf("user@%d.service", uid),
+			"app.slice",
+		),
+	}
+	// A cgroup with processes cannot have child cgroups with controllers enabled,
+	// so the command's cgroup is created next to the current one
+	if current == "/" {
+		candidates = append(candidates, mountpoint)
+	} else {
+		candidates = append(candidates, filepath.Join(mountpoint, filepath.Dir(current)))
+	}
+
+	for _, candidate := range candidates {
+		if unix.Access(candidate, unix.W_OK) == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no writable cgroup found; tried %s", strings.Join(candidates, ", "))
+}
+
+// writeCgroupFile writes a value to a cgroup interface file
+func writeCgroupFile(dir, name, value string) error {
+	return os.WriteFile(filepath.Join(dir, name), []byte(value), 0)
+}
+
+// readCgroupStat reads a flat keyed cgroup file such as cpu.stat
+func readCgroupStat(path string) (map[string]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	stat := make(map[string]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+			stat[key] = n
+		}
+	}
+	return stat, nil
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatMicroseconds formats a duration in microseconds as seconds
+func formatMicroseconds(usec uint64) string {
+	return fmt.Sprintf("%.2fs", float64(usec)/1e6)
+}
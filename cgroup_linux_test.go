@@ -0,0 +1,80 @@
+//go:build linux
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindCgroup2Mountpoint(t *testing.T) {
+	tests := []struct {
+		name      string
+		mountinfo string
+		want      string
+		wantOK    bool
+	}{
+		{
+			name: "unified hierarchy",
+			mountinfo: `22 1 0:21 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+35 22 0:30 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:9 - cgroup2 cgroup2 rw,nsdelegate`,
+			want:   "/sys/fs/cgroup",
+			wantOK: true,
+		},
+		{
+			name: "hybrid hierarchy",
+			mountinfo: `35 22 0:30 / /sys/fs/cgroup ro,nosuid,nodev,noexec shared:9 - tmpfs tmpfs ro,mode=755
+36 35 0:31 / /sys/fs/cgroup/unified rw,nosuid,nodev,noexec,relatime shared:10 - cgroup2 cgroup2 rw
+37 35 0:32 / /sys/fs/cgroup/memory rw,nosuid,nodev,noexec,relatime shared:11 - cgroup cgroup rw,memory`,
+			want:   "/sys/fs/cgroup/unified",
+			wantOK: true,
+		},
+		{
+			name:      "no cgroup2",
+			mountinfo: `37 35 0:32 / /sys/fs/cgroup/memory rw,nosuid,nodev,noexec,relatime shared:11 - cgroup cgroup rw,memory`,
+			wantOK:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := findCgroup2Mountpoint(strings.NewReader(tt.mountinfo))
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("findCgroup2Mountpoint() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFindCgroup2Path(t *testing.T) {
+	procCgroup := `4:memory:/user.slice
+1:name=systemd:/user.slice/user-1000.slice/session-2.scope
+0::/user.slice/user-1000.slice/session-2.scope`
+
+	got, ok := findCgroup2Path(strings.NewReader(procCgroup))
+	if !ok || got != "/user.slice/user-1000.slice/session-2.scope" {
+		t.Errorf("findCgroup2Path() = %q, %v", got, ok)
+	}
+
+	if _, ok := findCgroup2Path(strings.NewReader("4:memory:/user.slice\n")); ok {
+		t.Error("findCgroup2Path() found a path without a cgroup v2 entry")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want string
+	}{
+		{n: 512, want: "512 B"},
+		{n: 1536, want: "1.5 KiB"},
+		{n: 256 << 20, want: "256.0 MiB"},
+		{n: 3 << 30, want: "3.0 GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
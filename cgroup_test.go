@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCgroupConfigParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  CgroupConfig
+		want    CgroupLimits
+		wantErr bool
+	}{
+		{
+			name:   "empty",
+			config: CgroupConfig{},
+			want:   CgroupLimits{},
+		},
+		{
+			name: "all limits",
+			config: CgroupConfig{
+				MemoryMax: "2G",
+				PidsMax:   "512",
+				CPUMax:    "150%",
+				IOMax:     []string{"8:0 rbps=1048576 wbps=1048576"},
+			},
+			want: CgroupLimits{
+				MemoryMax: ptr(2 << 30),
+				PidsMax:   ptr(512),
+				CPUMax:    &CPUMax{Quota: 150000, Period: 100000},
+				IOMax:     []string{"8:0 rbps=1048576 wbps=1048576"},
+			},
+		},
+		{
+			name:   "cpu.max format",
+			config: CgroupConfig{CPUMax: "50000 200000"},
+			want:   CgroupLimits{CPUMax: &CPUMax{Quota: 50000, Period: 200000}},
+		},
+		{
+			name:   "cpu.max quota only",
+			config: CgroupConfig{CPUMax: "50000"},
+			want:   CgroupLimits{CPUMax: &CPUMax{Quota: 50000, Period: 100000}},
+		},
+		{
+			name:   "max leaves limits unset",
+			config: CgroupConfig{MemoryMax: "max", PidsMax: "max", CPUMax: "max"},
+			want:   CgroupLimits{},
+		},
+		{
+			name:    "invalid memory",
+			config:  CgroupConfig{MemoryMax: "a lot"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid percentage",
+			config:  CgroupConfig{CPUMax: "0%"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid io.max",
+			config:  CgroupConfig{IOMax: []string{"8:0"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.Parse()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCgroupLimitsMin(t *testing.T) {
+	a := CgroupLimits{
+		MemoryMax: ptr(4 << 30),
+		CPUMax:    &CPUMax{Quota: 50000, Period: 100000},
+		IOMax:     []string{"8:0 rbps=1000"},
+	}
+	b := CgroupLimits{
+		MemoryMax: ptr(2 << 30),
+		PidsMax:   ptr(100),
+		CPUMax:    &CPUMax{Quota: 100000, Period: 100000},
+		IOMax:     []string{"8:16 wbps=1000"},
+	}
+
+	want := CgroupLimits{
+		MemoryMax: ptr(2 << 30),
+		PidsMax:   ptr(100),
+		CPUMax:    &CPUMax{Quota: 50000, Period: 100000},
+		IOMax:     []string{"8:0 rbps=1000", "8:16 wbps=1000"},
+	}
+	if got := a.Min(b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Min() = %+v, want %+v", got, want)
+	}
+	if got := (CgroupLimits{}).Min(a); !reflect.DeepEqual(got, a) {
+		t.Errorf("Min() with empty limits = %+v, want %+v", got, a)
+	}
+}
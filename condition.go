@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"slices"
+)
+
+// knownOS and knownArch are the values of GOOS and GOARCH that conditions can refer to
+var (
+	knownOS = []string{
+		"aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios", "js",
+		"linux", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows",
+	}
+	knownArch = []string{
+		"386", "amd64", "arm", "arm64", "loong64", "mips", "mips64", "mips64le", "mipsle",
+		"ppc64", "ppc64le", "riscv64", "s390x", "wasm",
+	}
+)
+
+// Condition limits a preset or a path to some machines
+// All of its fields must match, and an empty field matches any machine
+type Condition struct {
+	// OS are the operating systems, as in GOOS
+	OS []string `yaml:"os,omitempty"`
+	// Arch are the architectures, as in GOARCH
+	Arch []string `yaml:"arch,omitempty"`
+	// Hostname is a glob pattern of the host name
+	Hostname string `yaml:"hostname,omitempty"`
+}
+
+// Validate checks the operating systems, architectures and the host name pattern
+func (c *Condition) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, goos := range c.OS {
+		if !slices.Contains(knownOS, goos) {
+			return fmt.Errorf("invalid os %q in when: must be a GOOS value like linux or darwin", goos)
+		}
+	}
+	for _, arch := range c.Arch {
+		if !slices.Contains(knownArch, arch) {
+			return fmt.Errorf("invalid arch %q in when: must be a GOARCH value like amd64 or arm64", arch)
+		}
+	}
+	if _, err := path.Match(c.Hostname, ""); err != nil {
+		return fmt.Errorf("invalid hostname pattern %q in when: %w", c.Hostname, err)
+	}
+	return nil
+}
+
+// Matches reports whether the current machine matches the condition
+// A nil condition matches any machine
+func (c *Condition) Matches() bool {
+	if c == nil {
+		return true
+	}
+	if len(c.OS) > 0 && !slices.Contains(c.OS, runtime.GOOS) {
+		return false
+	}
+	if len(c.Arch) > 0 && !slices.Contains(c.Arch, runtime.GOARCH) {
+		return false
+	}
+	if c.Hostname != "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return false
+		}
+		if ok, _ := path.Match(c.Hostname, hostname); !ok {
+			return false
+		}
+	}
+	return true
+}
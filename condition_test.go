@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestConditionMatches(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skip("no host name")
+	}
+	otherOS := "windows"
+	if runtime.GOOS == otherOS {
+		otherOS = "linux"
+	}
+
+	tests := []struct {
+		name      string
+		condition *Condition
+		want      bool
+	}{
+		{name: "nil", condition: nil, want: true},
+		{name: "empty", condition: &Condition{}, want: true},
+		{name: "current os", condition: &Condition{OS: []string{otherOS, runtime.GOOS}}, want: true},
+		{name: "other os", condition: &Condition{OS: []string{otherOS}}, want: false},
+		{name: "current arch", condition: &Condition{Arch: []string{runtime.GOARCH}}, want: true},
+		{name: "other arch", condition: &Condition{Arch: []string{"wasm"}}, want: runtime.GOARCH == "wasm"},
+		{name: "hostname pattern", condition: &Condition{Hostname: hostname[:1] + "*"}, want: true},
+		{name: "other hostname", condition: &Condition{Hostname: hostname + "-other"}, want: false},
+		{
+			name:      "all fields must match",
+			condition: &Condition{OS: []string{runtime.GOOS}, Hostname: hostname + "-other"},
+			want:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.condition.Matches(); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition *Condition
+		wantErr   bool
+	}{
+		{name: "nil", condition: nil},
+		{name: "valid", condition: &Condition{OS: []string{"linux", "darwin"}, Arch: []string{"arm64"}, Hostname: "ci-*"}},
+		{name: "unknown os", condition: &Condition{OS: []string{"macos"}}, wantErr: true},
+		{name: "unknown arch", condition: &Condition{Arch: []string{"x86_64"}}, wantErr: true},
+		{name: "invalid hostname pattern", condition: &Condition{Hostname: "[ci"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.condition.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -5,9 +5,13 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
 )
@@ -15,23 +19,117 @@ import (
 type Config struct {
 	Presets     map[string]Preset `yaml:"presets"`
 	AutoPresets []AutoPresetRule  `yaml:"auto-presets"`
+
+	// files are the configuration files that were loaded, in the order they were merged
+	files []string
+	// presetOrigins are the files the presets were loaded from
+	presetOrigins map[string]string
+	// replacedPresetOrigins are the earlier files whose presets were replaced by a preset with the same name
+	replacedPresetOrigins map[string][]string
+	// autoPresetOrigins are the files the auto-preset rules were loaded from, in the order of AutoPresets
+	autoPresetOrigins []string
+	// projectConfig is the trusted project configuration that was loaded, if any
+	projectConfig string
 }
 
+// systemConfigPath is the configuration file shared by all users
+const systemConfigPath = "/etc/cage/presets.yaml"
+
+// cageConfigEnv is the environment variable with additional configuration files, separated like PATH
+const cageConfigEnv = "CAGE_CONFIG"
+
 type Preset struct {
-	Allow         []AllowPath `yaml:"allow"`
-	AllowKeychain bool        `yaml:"allow-keychain"`
-	AllowGit      bool        `yaml:"allow-git"`
+	// Extends are presets applied before this one, as if they were given with -preset
+	// When limits the preset to some machines; the presets it extends have their own conditions
+	Extends              []string      `yaml:"extends"`
+	When                 *Condition    `yaml:"when"`
+	Allow                []AllowPath   `yaml:"allow"`
+	Read                 []AllowPath   `yaml:"read"`
+	Exec                 []AllowPath   `yaml:"exec"`
+	AllowKeychain        bool          `yaml:"allow-keychain"`
+	AllowGit             bool          `yaml:"allow-git"`
+	Connect              []uint16      `yaml:"connect"`
+	Bind                 []uint16      `yaml:"bind"`
+	ScopeSignals         bool          `yaml:"scope-signals"`
+	ScopeAbstractSockets bool          `yaml:"scope-abstract-sockets"`
+	Network              NetworkPolicy `yaml:"network"`
+	MinABI               int           `yaml:"min-abi"`
+	Syscalls             SyscallPolicy `yaml:"syscalls"`
+	Limits               LimitsConfig  `yaml:"limits"`
+	Cgroup               CgroupConfig  `yaml:"cgroup"`
+	Env                  EnvConfig     `yaml:"env"`
+	Timeout              time.Duration `yaml:"timeout"`
+
+	// configDir is the directory of the configuration file that defines the preset
+	configDir string
+}
+
+// SyscallPolicy configures the seccomp system call filter (only for Linux)
+type SyscallPolicy struct {
+	// Deny lists system calls to deny in addition to the default denylist
+	Deny []string `yaml:"deny"`
+	// Allow lists system calls to remove from the default denylist
+	Allow []string `yaml:"allow"`
+	// Action is either "errno" (fail with EPERM, the default) or "kill"
+	Action string `yaml:"action"`
 }
 
+// Seccomp actions for denied system calls
+const (
+	SyscallActionErrno = "errno"
+	SyscallActionKill  = "kill"
+)
+
+// NetworkPolicy configures network access
+// It is either the string "none" to deny all network access, or a map of options
+type NetworkPolicy struct {
+	// None denies all network access except loopback
+	None bool `yaml:"-"`
+	// AllowHosts are hosts reachable through the built-in HTTP proxy
+	// If set, all other network connections are denied
+	AllowHosts []string `yaml:"allow-hosts"`
+}
+
+// NetworkNone is the network policy value that denies all network access
+const NetworkNone = "none"
+
 type AllowPath struct {
-	Path         string `yaml:"path"`
-	EvalSymLinks bool   `yaml:"eval-symlinks,omitempty"`
+	Path         string     `yaml:"path"`
+	EvalSymLinks bool       `yaml:"eval-symlinks,omitempty"`
+	When         *Condition `yaml:"when,omitempty"`
+	// Create is "file" or "directory" to create the path before the command runs if it does not exist
+	// Landlock only grants access to existing paths, so the entry would be left out otherwise
+	Create string `yaml:"create,omitempty"`
 }
 
+// Kinds of paths created for allow entries
+const (
+	AllowCreateFile      = "file"
+	AllowCreateDirectory = "directory"
+)
+
+// AutoPresetRule applies presets to commands that match all of its conditions
 type AutoPresetRule struct {
-	Command        string   `yaml:"command,omitempty"`
-	CommandPattern string   `yaml:"command-pattern,omitempty"`
-	Presets        []string `yaml:"presets"`
+	Command        string `yaml:"command,omitempty"`
+	CommandPattern string `yaml:"command-pattern,omitempty"`
+	// ArgsPattern is a regular expression matched against the arguments joined with spaces
+	ArgsPattern string `yaml:"args-pattern,omitempty"`
+	// Subcommand is compared with the first argument that does not start with "-"
+	Subcommand string `yaml:"subcommand,omitempty"`
+	// CwdPattern is a regular expression matched against the working directory
+	CwdPattern string `yaml:"cwd-pattern,omitempty"`
+	// CwdUnder is a directory the working directory must be or be under
+	CwdUnder string `yaml:"cwd-under,omitempty"`
+	// Env maps environment variables to glob patterns their values must match
+	// The variables must be set
+	Env map[string]string `yaml:"env,omitempty"`
+	// WhenFile is a glob pattern of a file that must exist in the working directory or one of its parents,
+	// like package.json or *.csproj
+	WhenFile string `yaml:"when-file,omitempty"`
+	// Presets are applied to matching commands
+	Presets []string `yaml:"presets"`
+	// ExcludePresets are removed from the presets applied by any rule to matching commands
+	ExcludePresets []string `yaml:"exclude-presets,omitempty"`
 }
 
 func (p *AllowPath) UnmarshalYAML(b []byte) error {
@@ -59,6 +157,34 @@ func (p *AllowPath) UnmarshalYAML(b []byte) error {
 	}
 }
 
+func (n *NetworkPolicy) UnmarshalYAML(b []byte) error {
+	var a any
+	if err := yaml.Unmarshal(b, &a); err != nil {
+		return fmt.Errorf("unmarshal NetworkPolicy: %w", err)
+	}
+	switch v := a.(type) {
+	case nil:
+		*n = NetworkPolicy{}
+		return nil
+	case string:
+		if v != NetworkNone {
+			return fmt.Errorf("unmarshal NetworkPolicy: unsupported value %q", v)
+		}
+		*n = NetworkPolicy{None: true}
+		return nil
+	case map[string]any:
+		type alias NetworkPolicy
+		var np alias
+		if err := yaml.Unmarshal(b, &np); err != nil {
+			return fmt.Errorf("unmarshal NetworkPolicy map: %w", err)
+		}
+		*n = (NetworkPolicy)(np)
+		return nil
+	default:
+		return fmt.Errorf("unmarshal NetworkPolicy: unsupported type %T", a)
+	}
+}
+
 func userConfigDir() (string, error) {
 	// os.UserConfigDir() does not respect XDG_CONFIG_HOME on darwin.
 	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
@@ -67,30 +193,136 @@ func userConfigDir() (string, error) {
 	return os.UserConfigDir()
 }
 
-func loadConfig(configPath string) (*Config, error) {
-	paths := []string{}
+// configFile is a configuration file to load
+type configFile struct {
+	path string
+	// data is the content of a trusted project configuration, whose trust was checked on this content
+	// The file is not read again, so that it cannot be changed in the meantime
+	data []byte
+}
+
+// configPaths returns the paths of the configuration files returned by configFiles
+func configPaths(flagPaths []string) []string {
+	var paths []string
+	for _, file := range configFiles(flagPaths) {
+		paths = append(paths, file.path)
+	}
+	return paths
+}
+
+// configFiles returns the configuration files to load in the order they are merged:
+// the system configuration, the user configuration, the trusted project configuration,
+// the files in CAGE_CONFIG and the files given with -config
+func configFiles(flagPaths []string) []configFile {
+	paths := []string{systemConfigPath}
 
-	if configPath != "" {
-		paths = append(paths, configPath)
-	} else {
-		configDir, err := userConfigDir()
-		if err == nil {
-			paths = append(paths, filepath.Join(configDir, "cage", "presets.yaml"))
-			paths = append(paths, filepath.Join(configDir, "cage", "presets.yml"))
+	if configDir, err := userConfigDir(); err == nil {
+		// presets.yml is only used if there is no presets.yaml
+		userPath := filepath.Join(configDir, "cage", "presets.yaml")
+		if _, err := os.Stat(userPath); os.IsNotExist(err) {
+			yml := filepath.Join(configDir, "cage", "presets.yml")
+			if _, err := os.Stat(yml); err == nil {
+				userPath = yml
+			}
 		}
+		paths = append(paths, userPath)
 	}
 
+	var files []configFile
 	for _, path := range paths {
-		config, err := loadConfigFromFile(path)
-		if err == nil {
-			return config, nil
+		files = append(files, configFile{path: path})
+	}
+
+	if projectPath, data, ok := trustedProjectConfig(); ok {
+		files = append(files, configFile{path: projectPath, data: data})
+	}
+
+	for _, path := range filepath.SplitList(os.Getenv(cageConfigEnv)) {
+		if path != "" {
+			files = append(files, configFile{path: path})
+		}
+	}
+
+	for _, path := range flagPaths {
+		files = append(files, configFile{path: path})
+	}
+	return files
+}
+
+// loadConfig loads the configuration files at paths and merges them in order
+// Files that do not exist are skipped
+func loadConfig(paths ...string) (*Config, error) {
+	var files []configFile
+	for _, path := range paths {
+		files = append(files, configFile{path: path})
+	}
+	return loadConfigFiles(files)
+}
+
+// loadConfigFiles loads configuration files and merges them in order
+// Files that do not exist are skipped
+func loadConfigFiles(files []configFile) (*Config, error) {
+	config := &Config{
+		Presets:       make(map[string]Preset),
+		presetOrigins: make(map[string]string),
+	}
+
+	for _, file := range files {
+		var layer *Config
+		var err error
+		if file.data != nil {
+			layer, err = loadConfigFromBytes(file.data)
+		} else {
+			layer, err = loadConfigFromFile(file.path)
+		}
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error loading config from %s: %w", file.path, err)
+		}
+		config.merge(layer, file.path)
+		if file.data != nil {
+			config.projectConfig = file.path
 		}
-		if !os.IsNotExist(err) {
-			return nil, fmt.Errorf("error loading config from %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// merge adds the presets and auto-preset rules of a configuration loaded from origin
+// Presets replace presets with the same name as a whole, and auto-preset rules replace rules with the same conditions;
+// other presets and rules are added
+// Presets are extended with extends under another name instead
+func (c *Config) merge(layer *Config, origin string) {
+	c.files = append(c.files, origin)
+
+	configDir := ""
+	if abs, err := filepath.Abs(origin); err == nil {
+		configDir = filepath.Dir(abs)
+	}
+	for name, preset := range layer.Presets {
+		preset.configDir = configDir
+		c.Presets[name] = preset
+		if previous, ok := c.presetOrigins[name]; ok {
+			if c.replacedPresetOrigins == nil {
+				c.replacedPresetOrigins = make(map[string][]string)
+			}
+			c.replacedPresetOrigins[name] = append(c.replacedPresetOrigins[name], previous)
 		}
+		c.presetOrigins[name] = origin
 	}
 
-	return &Config{Presets: make(map[string]Preset)}, nil
+	for _, rule := range layer.AutoPresets {
+		i := slices.IndexFunc(c.AutoPresets, rule.sameConditions)
+		if i >= 0 {
+			c.AutoPresets[i] = rule
+			c.autoPresetOrigins[i] = origin
+			continue
+		}
+		c.AutoPresets = append(c.AutoPresets, rule)
+		c.autoPresetOrigins = append(c.autoPresetOrigins, origin)
+	}
 }
 
 func loadConfigFromFile(path string) (*Config, error) {
@@ -104,7 +336,11 @@ func loadConfigFromFile(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	return loadConfigFromBytes(data)
+}
 
+// loadConfigFromBytes parses the content of a configuration file
+func loadConfigFromBytes(data []byte) (*Config, error) {
 	var config Config
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, err
@@ -126,42 +362,245 @@ func (c *Config) ListPresets() []string {
 	return presets
 }
 
-// GetAutoPresets returns the preset names that should be automatically applied for the given command
-func (c *Config) GetAutoPresets(command string) ([]string, error) {
-	var presets []string
+// ResolvePresets returns the presets to apply for the given preset names in order
+// Each preset is preceded by the presets it extends, depth-first in the order they are listed,
+// and presets that occur more than once are only applied the first time
+// A preset whose condition does not match the current machine is left out with the presets it extends,
+// but they are still checked for cycles and unknown presets
+func (c *Config) ResolvePresets(names []string) ([]string, error) {
+	var resolved []string
+	var visit func(name string, chain []string, apply bool) error
+	visit = func(name string, chain []string, apply bool) error {
+		if i := slices.Index(chain, name); i >= 0 {
+			return &presetCycleError{cycle: append(slices.Clone(chain[i:]), name)}
+		}
+		if slices.Contains(resolved, name) {
+			return nil
+		}
+		preset, ok := c.GetPreset(name)
+		if !ok {
+			if len(chain) > 0 {
+				return fmt.Errorf("preset '%s' extends unknown preset '%s'", chain[len(chain)-1], name)
+			}
+			return fmt.Errorf("preset '%s' not found", name)
+		}
+		apply = apply && preset.When.Matches()
+		chain = append(chain, name)
+		for _, parent := range preset.Extends {
+			if err := visit(parent, chain, apply); err != nil {
+				return err
+			}
+		}
+		if apply {
+			resolved = append(resolved, name)
+		}
+		return nil
+	}
 
-	// Extract just the base command name from the full path
-	baseCommand := filepath.Base(command)
+	for _, name := range names {
+		if err := visit(name, nil, true); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
 
-	for _, rule := range c.AutoPresets {
-		matched := false
+// presetCycleError is returned when presets extend each other in a cycle
+type presetCycleError struct {
+	// cycle are the presets in the cycle, starting and ending with the same preset
+	cycle []string
+}
+
+func (e *presetCycleError) Error() string {
+	return fmt.Sprintf("preset '%s' extends itself: %s", e.cycle[0], strings.Join(e.cycle, " -> "))
+}
 
-		// Check exact command match
-		if rule.Command != "" && rule.Command == baseCommand {
-			matched = true
+// GetAutoPresets returns the preset names that should be automatically applied for the given command and arguments
+// Presets excluded by a matching rule are left out
+func (c *Config) GetAutoPresets(command string, args ...string) ([]string, error) {
+	presets, excluded, err := c.matchAutoPresets(command, args)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(presets, func(preset string) bool {
+		return slices.Contains(excluded, preset)
+	}), nil
+}
+
+// ResolveCommandPresets returns the presets to apply to a command, each preceded by the presets it extends:
+// the given presets first, then the auto-presets of the command
+// Presets excluded by a matching rule are left out even when another preset extends them,
+// unless they are given explicitly
+func (c *Config) ResolveCommandPresets(presets []string, command string, args ...string) ([]string, error) {
+	autoPresets, excluded, err := c.matchAutoPresets(command, args)
+	if err != nil {
+		return nil, fmt.Errorf("error detecting auto-presets: %w", err)
+	}
+	resolved, err := c.ResolvePresets(append(slices.Clone(presets), autoPresets...))
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(resolved, func(preset string) bool {
+		return slices.Contains(excluded, preset) && !slices.Contains(presets, preset)
+	}), nil
+}
+
+// matchAutoPresets returns the presets of the rules matching a command and the presets they exclude
+// The interactive preset of the trusted project configuration is applied to every command
+func (c *Config) matchAutoPresets(command string, args []string) (presets, excluded []string, err error) {
+	for _, rule := range c.AutoPresets {
+		matched, err := rule.matches(command, args)
+		if err != nil {
+			return nil, nil, err
 		}
+		if matched {
+			presets = append(presets, rule.Presets...)
+			excluded = append(excluded, rule.ExcludePresets...)
+		}
+	}
+	if c.projectConfig != "" && c.presetOrigins[interactivePresetName] == c.projectConfig {
+		presets = append(presets, interactivePresetName)
+	}
+	return presets, excluded, nil
+}
 
-		// Check regex pattern match
-		if !matched && rule.CommandPattern != "" {
-			re, err := regexp.Compile(rule.CommandPattern)
+// matches reports whether a command run in the current working directory and environment matches all conditions of the rule
+// A rule without conditions matches no command
+func (r *AutoPresetRule) matches(command string, args []string) (bool, error) {
+	if !r.hasConditions() {
+		return false, nil
+	}
+
+	// Extract just the base command name from the full path
+	baseCommand := filepath.Base(command)
+
+	// The command matches either the exact command or the pattern
+	if r.Command != "" || r.CommandPattern != "" {
+		matched := r.Command != "" && r.Command == baseCommand
+		if !matched && r.CommandPattern != "" {
+			re, err := regexp.Compile(r.CommandPattern)
 			if err != nil {
-				return nil, fmt.Errorf(
+				return false, fmt.Errorf(
 					"invalid regex pattern in auto-preset: %s: %w",
-					rule.CommandPattern,
+					r.CommandPattern,
 					err,
 				)
 			}
-			if re.MatchString(baseCommand) {
-				matched = true
+			matched = re.MatchString(baseCommand)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+
+	if r.ArgsPattern != "" {
+		re, err := regexp.Compile(r.ArgsPattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid args-pattern in auto-preset: %s: %w", r.ArgsPattern, err)
+		}
+		if !re.MatchString(strings.Join(args, " ")) {
+			return false, nil
+		}
+	}
+
+	if r.Subcommand != "" {
+		i := slices.IndexFunc(args, func(arg string) bool { return !strings.HasPrefix(arg, "-") })
+		if i < 0 || args[i] != r.Subcommand {
+			return false, nil
+		}
+	}
+
+	if r.CwdPattern != "" || r.CwdUnder != "" || r.WhenFile != "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return false, fmt.Errorf("get working directory: %w", err)
+		}
+		if r.CwdPattern != "" {
+			re, err := regexp.Compile(r.CwdPattern)
+			if err != nil {
+				return false, fmt.Errorf("invalid cwd-pattern in auto-preset: %s: %w", r.CwdPattern, err)
+			}
+			if !re.MatchString(cwd) {
+				return false, nil
+			}
+		}
+		if r.CwdUnder != "" {
+			dir, err := filepath.Abs(expandEnvOnly(r.CwdUnder))
+			if err != nil {
+				return false, fmt.Errorf("invalid cwd-under in auto-preset: %s: %w", r.CwdUnder, err)
+			}
+			if !isUnder(cwd, dir) {
+				return false, nil
+			}
+		}
+		if r.WhenFile != "" {
+			found, err := findMarker(cwd, r.WhenFile)
+			if err != nil {
+				return false, fmt.Errorf("invalid when-file in auto-preset: %s: %w", r.WhenFile, err)
+			}
+			if !found {
+				return false, nil
 			}
 		}
+	}
 
-		if matched {
-			presets = append(presets, rule.Presets...)
+	for name, pattern := range r.Env {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return false, nil
+		}
+		matched, err := matchEnvValue(pattern, value)
+		if err != nil {
+			return false, fmt.Errorf("invalid env pattern in auto-preset: %s=%s: %w", name, pattern, err)
+		}
+		if !matched {
+			return false, nil
 		}
 	}
 
-	return presets, nil
+	return true, nil
+}
+
+// hasConditions reports whether the rule has any condition
+func (r *AutoPresetRule) hasConditions() bool {
+	return r.Command != "" || r.CommandPattern != "" || r.ArgsPattern != "" || r.Subcommand != "" ||
+		r.CwdPattern != "" || r.CwdUnder != "" || len(r.Env) > 0 || r.WhenFile != ""
+}
+
+// globEscaper escapes glob metacharacters
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+
+// findMarker reports whether a file matching the glob pattern exists in dir or one of its parents
+func findMarker(dir, pattern string) (bool, error) {
+	for ; ; dir = filepath.Dir(dir) {
+		// Directories like Next.js routes can contain glob metacharacters
+		matches, err := filepath.Glob(filepath.Join(globEscaper.Replace(dir), pattern))
+		if err != nil {
+			return false, err
+		}
+		if len(matches) > 0 {
+			return true, nil
+		}
+		if dir == filepath.Dir(dir) {
+			return false, nil
+		}
+	}
+}
+
+// sameConditions reports whether two rules match the same commands
+func (r *AutoPresetRule) sameConditions(other AutoPresetRule) bool {
+	a, b := *r, other
+	a.Presets, a.ExcludePresets = nil, nil
+	b.Presets, b.ExcludePresets = nil, nil
+	if len(a.Env) == 0 && len(b.Env) == 0 {
+		a.Env, b.Env = nil, nil
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// matchEnvValue reports whether the value of an environment variable matches a glob pattern of an auto-preset rule
+func matchEnvValue(pattern, value string) (bool, error) {
+	return path.Match(pattern, value)
 }
 
 // expandEnvOnly expands environment variables in a path
@@ -183,16 +622,129 @@ func getGitCommonDir() (string, error) {
 }
 
 // ProcessPreset expands all dynamic values in a preset
+// Presets and paths whose conditions do not match the current machine are left out
 func (p *Preset) ProcessPreset() (*Preset, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	if !p.When.Matches() {
+		return &Preset{}, nil
+	}
+
+	allowPaths, err := expandAllowPaths(p.Allow, p.configDir)
+	if err != nil {
+		return nil, err
+	}
+	readPaths, err := expandAllowPaths(p.Read, p.configDir)
+	if err != nil {
+		return nil, err
+	}
+	execPaths, err := expandAllowPaths(p.Exec, p.configDir)
+	if err != nil {
+		return nil, err
+	}
+
 	processed := &Preset{
-		AllowKeychain: p.AllowKeychain,
-		AllowGit:      p.AllowGit,
-		Allow:         make([]AllowPath, 0, len(p.Allow)),
+		Extends:              p.Extends,
+		AllowKeychain:        p.AllowKeychain,
+		AllowGit:             p.AllowGit,
+		Allow:                allowPaths,
+		Read:                 readPaths,
+		Exec:                 execPaths,
+		Connect:              p.Connect,
+		Bind:                 p.Bind,
+		ScopeSignals:         p.ScopeSignals,
+		ScopeAbstractSockets: p.ScopeAbstractSockets,
+		Network:              p.Network,
+		MinABI:               p.MinABI,
+		Syscalls:             p.Syscalls,
+		Limits:               p.Limits,
+		Cgroup:               p.Cgroup,
+		Env:                  expandEnvConfig(p.Env),
+		Timeout:              p.Timeout,
+	}
+	return processed, nil
+}
+
+// Validate checks the settings of a preset that cannot be checked when it is decoded
+func (p *Preset) Validate() error {
+	switch p.Syscalls.Action {
+	case "", SyscallActionErrno, SyscallActionKill:
+	default:
+		return fmt.Errorf(
+			"invalid syscalls action %q: must be %q or %q",
+			p.Syscalls.Action,
+			SyscallActionErrno,
+			SyscallActionKill,
+		)
 	}
 
-	// Expand environment variables in paths
+	if _, err := p.Limits.Parse(); err != nil {
+		return err
+	}
+	if _, err := p.Cgroup.Parse(); err != nil {
+		return err
+	}
+	if err := p.Env.Validate(); err != nil {
+		return err
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s: must not be negative", p.Timeout)
+	}
+	if err := p.When.Validate(); err != nil {
+		return err
+	}
+	for _, path := range slices.Concat(p.Allow, p.Read, p.Exec) {
+		if err := path.When.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", path.Path, err)
+		}
+	}
+	for _, path := range slices.Concat(p.Read, p.Exec) {
+		if path.Create != "" {
+			return fmt.Errorf("%s: create is only supported in allow", path.Path)
+		}
+	}
 	for _, path := range p.Allow {
-		expanded := os.ExpandEnv(path.Path)
+		switch path.Create {
+		case "", AllowCreateFile, AllowCreateDirectory:
+		default:
+			return fmt.Errorf(
+				"%s: invalid create %q: must be %q or %q",
+				path.Path,
+				path.Create,
+				AllowCreateFile,
+				AllowCreateDirectory,
+			)
+		}
+	}
+	return nil
+}
+
+// expandEnvConfig expands environment variables in the values of env.set
+func expandEnvConfig(env EnvConfig) EnvConfig {
+	if env.Set == nil {
+		return env
+	}
+	set := make(map[string]string, len(env.Set))
+	for name, value := range env.Set {
+		set[name] = expandEnvOnly(value)
+	}
+	env.Set = set
+	return env
+}
+
+// expandAllowPaths expands ~ and variables and resolves symlinks in paths of a preset defined in configDir
+// Paths whose conditions do not match the current machine are left out
+func expandAllowPaths(paths []AllowPath, configDir string) ([]AllowPath, error) {
+	expandedPaths := make([]AllowPath, 0, len(paths))
+	for _, path := range paths {
+		if !path.When.Matches() {
+			continue
+		}
+		expanded, err := expandPath(path.Path, configDir)
+		if err != nil {
+			return nil, err
+		}
 		if path.EvalSymLinks {
 			// Resolve symlinks if EvalSymLinks is true
 			resolvedPath, err := filepath.EvalSymlinks(expanded)
@@ -202,8 +754,7 @@ func (p *Preset) ProcessPreset() (*Preset, error) {
 			expanded = resolvedPath
 		}
 
-		processed.Allow = append(processed.Allow, AllowPath{Path: expanded})
+		expandedPaths = append(expandedPaths, AllowPath{Path: expanded, Create: path.Create})
 	}
-
-	return processed, nil
+	return expandedPaths, nil
 }
@@ -3,8 +3,11 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/goccy/go-yaml"
 )
@@ -90,6 +93,119 @@ func TestLoadConfig(t *testing.T) {
 	}
 }
 
+func TestLoadConfigLayers(t *testing.T) {
+	tmpDir := t.TempDir()
+	systemPath := filepath.Join(tmpDir, "system.yaml")
+	os.WriteFile(systemPath, []byte(`presets:
+  npm:
+    allow:
+      - "$HOME/.npm"
+  base:
+    allow:
+      - "."
+auto-presets:
+  - command: npm
+    presets:
+      - npm
+  - command: make
+    presets:
+      - base`), 0o644)
+	projectPath := filepath.Join(tmpDir, "project.yaml")
+	os.WriteFile(projectPath, []byte(`presets:
+  npm:
+    extends: [base]
+  local:
+    extends: [base]
+    allow:
+      - "./out"
+auto-presets:
+  - command: npm
+    presets:
+      - npm
+      - local`), 0o644)
+
+	config, err := loadConfig(systemPath, filepath.Join(tmpDir, "missing.yaml"), projectPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(config.files, []string{systemPath, projectPath}) {
+		t.Errorf("files = %v, want %v", config.files, []string{systemPath, projectPath})
+	}
+
+	// Presets from later files replace presets with the same name
+	npm, _ := config.GetPreset("npm")
+	if len(npm.Allow) != 0 || !reflect.DeepEqual(npm.Extends, []string{"base"}) {
+		t.Errorf("npm preset = %+v, want the one from the project config", npm)
+	}
+	wantOrigins := map[string]string{"npm": projectPath, "base": systemPath, "local": projectPath}
+	if !reflect.DeepEqual(config.presetOrigins, wantOrigins) {
+		t.Errorf("presetOrigins = %v, want %v", config.presetOrigins, wantOrigins)
+	}
+	wantReplaced := map[string][]string{"npm": {systemPath}}
+	if !reflect.DeepEqual(config.replacedPresetOrigins, wantReplaced) {
+		t.Errorf("replacedPresetOrigins = %v, want %v", config.replacedPresetOrigins, wantReplaced)
+	}
+
+	// A preset from an earlier file is extended by a preset with another name
+	resolved, err := config.ResolvePresets([]string{"local"})
+	if err != nil {
+		t.Fatalf("ResolvePresets() error = %v", err)
+	}
+	var allow []string
+	for _, name := range resolved {
+		preset, _ := config.GetPreset(name)
+		for _, path := range preset.Allow {
+			allow = append(allow, path.Path)
+		}
+	}
+	if want := []string{".", "./out"}; !reflect.DeepEqual(allow, want) {
+		t.Errorf("allow paths of local = %v, want %v", allow, want)
+	}
+
+	// Auto-preset rules for the same command are replaced in place
+	wantRules := []AutoPresetRule{
+		{Command: "npm", Presets: []string{"npm", "local"}},
+		{Command: "make", Presets: []string{"base"}},
+	}
+	if !reflect.DeepEqual(config.AutoPresets, wantRules) {
+		t.Errorf("AutoPresets = %+v, want %+v", config.AutoPresets, wantRules)
+	}
+	if !reflect.DeepEqual(config.autoPresetOrigins, []string{projectPath, systemPath}) {
+		t.Errorf("autoPresetOrigins = %v", config.autoPresetOrigins)
+	}
+}
+
+func TestConfigPaths(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	// There is no project configuration in the working directory
+	t.Chdir(t.TempDir())
+	t.Setenv(cageConfigEnv, "/a.yaml"+string(os.PathListSeparator)+"/b.yaml")
+
+	got := configPaths([]string{"/c.yaml"})
+	want := []string{
+		systemConfigPath,
+		filepath.Join(configHome, "cage", "presets.yaml"),
+		"/a.yaml",
+		"/b.yaml",
+		"/c.yaml",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("configPaths() = %v, want %v", got, want)
+	}
+
+	// presets.yml is used if there is no presets.yaml
+	os.MkdirAll(filepath.Join(configHome, "cage"), 0o755)
+	os.WriteFile(filepath.Join(configHome, "cage", "presets.yml"), []byte("presets: {}"), 0o644)
+	t.Setenv(cageConfigEnv, "")
+	got = configPaths(nil)
+	want = []string{systemConfigPath, filepath.Join(configHome, "cage", "presets.yml")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("configPaths() = %v, want %v", got, want)
+	}
+}
+
 func TestConfigGetPreset(t *testing.T) {
 	config := &Config{
 		Presets: map[string]Preset{
@@ -347,16 +463,27 @@ func TestPresetWithAllowGit(t *testing.T) {
 	}
 }
 
-func TestProcessPresetWithAllowGit(t *testing.T) {
-	// This test will only check the AllowGit flag is preserved
-	// We can't easily test the git directory addition without a real git repo
-	preset := Preset{
-		Allow: []AllowPath{
-			{Path: "$HOME/.npm"},
-			{Path: "/tmp"},
-		},
-		AllowKeychain: true,
-		AllowGit:      true,
+func TestPresetWithReadPaths(t *testing.T) {
+	t.Setenv("TEST_DIR", "/test/directory")
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  test:
+    read:
+      - "$TEST_DIR/src"
+      - path: "/opt/toolchain"
+        eval-symlinks: true`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	preset, ok := config.GetPreset("test")
+	if !ok {
+		t.Fatal("preset 'test' not found")
 	}
 
 	processed, err := preset.ProcessPreset()
@@ -364,123 +491,773 @@ func TestProcessPresetWithAllowGit(t *testing.T) {
 		t.Fatalf("ProcessPreset() error = %v", err)
 	}
 
-	// Check that AllowGit is preserved
-	if processed.AllowGit != preset.AllowGit {
-		t.Errorf("ProcessPreset() AllowGit = %v, want %v", processed.AllowGit, preset.AllowGit)
+	want := []AllowPath{{Path: "/test/directory/src"}, {Path: "/opt/toolchain"}}
+	if !reflect.DeepEqual(processed.Read, want) {
+		t.Errorf("Read = %v, want %v", processed.Read, want)
 	}
+}
 
-	// Check that AllowKeychain is preserved
-	if processed.AllowKeychain != preset.AllowKeychain {
-		t.Errorf(
-			"ProcessPreset() AllowKeychain = %v, want %v",
-			processed.AllowKeychain,
-			preset.AllowKeychain,
-		)
+func TestPresetWithExecPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  test:
+    exec:
+      - "/usr/bin"
+      - "$HOME/.cargo/bin"
+      - "./node_modules/.bin"`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
 	}
 
-	// Check that paths are expanded
-	expectedPaths := []string{
-		os.Getenv("HOME") + "/.npm",
-		"/tmp",
+	preset, ok := config.GetPreset("test")
+	if !ok {
+		t.Fatal("preset 'test' not found")
 	}
 
-	// The git directory might be added if we're in a git repo, but we can't control that in tests
-	// So we check that at least the expected paths are present
-	if len(processed.Allow) < len(expectedPaths) {
-		t.Errorf(
-			"ProcessPreset() returned %d paths, want at least %d",
-			len(processed.Allow),
-			len(expectedPaths),
-		)
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
 	}
 
-	for i, expected := range expectedPaths {
-		if processed.Allow[i].Path != expected {
-			t.Errorf("ProcessPreset() path[%d] = %v, want %v", i, processed.Allow[i].Path, expected)
-		}
+	want := []AllowPath{
+		{Path: "/usr/bin"},
+		{Path: os.Getenv("HOME") + "/.cargo/bin"},
+		{Path: "./node_modules/.bin"},
+	}
+	if !reflect.DeepEqual(processed.Exec, want) {
+		t.Errorf("Exec = %v, want %v", processed.Exec, want)
 	}
 }
 
-func TestGetAutoPresets(t *testing.T) {
-	config := &Config{
-		Presets: map[string]Preset{
-			"claude-code": {Allow: []AllowPath{{Path: "/tmp"}}},
-			"npm":         {Allow: []AllowPath{{Path: "~/.npm"}}},
-			"python":      {Allow: []AllowPath{{Path: "~/.python"}}},
-		},
-		AutoPresets: []AutoPresetRule{
-			{
-				Command: "claude",
-				Presets: []string{"claude-code"},
-			},
-			{
-				CommandPattern: "^(npm|npx|yarn)$",
-				Presets:        []string{"npm"},
-			},
-			{
-				Command: "python",
-				Presets: []string{"python"},
-			},
-			{
-				CommandPattern: "^python[0-9]+$",
-				Presets:        []string{"python"},
-			},
-		},
+func TestPresetWithNetworkRules(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  test:
+    connect:
+      - 443
+      - 80
+    bind:
+      - 3000`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	preset, ok := config.GetPreset("test")
+	if !ok {
+		t.Fatal("preset 'test' not found")
+	}
+
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(processed.Connect, []uint16{443, 80}) {
+		t.Errorf("Connect = %v, want [443 80]", processed.Connect)
+	}
+	if !reflect.DeepEqual(processed.Bind, []uint16{3000}) {
+		t.Errorf("Bind = %v, want [3000]", processed.Bind)
+	}
+}
+
+func TestPresetWithMinABI(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  test:
+    min-abi: 4`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	preset, ok := config.GetPreset("test")
+	if !ok {
+		t.Fatal("preset 'test' not found")
+	}
+
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+
+	if processed.MinABI != 4 {
+		t.Errorf("MinABI = %d, want 4", processed.MinABI)
+	}
+}
+
+func TestPresetWithScopes(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  test:
+    scope-signals: true
+    scope-abstract-sockets: true`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
 	}
 
+	preset, ok := config.GetPreset("test")
+	if !ok {
+		t.Fatal("preset 'test' not found")
+	}
+
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+
+	if !processed.ScopeSignals {
+		t.Error("ScopeSignals = false, want true")
+	}
+	if !processed.ScopeAbstractSockets {
+		t.Error("ScopeAbstractSockets = false, want true")
+	}
+}
+
+func TestPresetWithNetworkPolicy(t *testing.T) {
 	tests := []struct {
-		name        string
-		command     string
-		wantPresets []string
-		wantErr     bool
+		name    string
+		content string
+		want    NetworkPolicy
+		wantErr bool
 	}{
 		{
-			name:        "exact command match",
-			command:     "claude",
-			wantPresets: []string{"claude-code"},
-			wantErr:     false,
-		},
-		{
-			name:        "exact command match with path",
-			command:     "/usr/bin/claude",
-			wantPresets: []string{"claude-code"},
-			wantErr:     false,
-		},
-		{
-			name:        "regex pattern match npm",
-			command:     "npm",
-			wantPresets: []string{"npm"},
-			wantErr:     false,
-		},
-		{
-			name:        "regex pattern match npx",
-			command:     "npx",
-			wantPresets: []string{"npm"},
-			wantErr:     false,
-		},
-		{
-			name:        "regex pattern match yarn",
-			command:     "/usr/local/bin/yarn",
-			wantPresets: []string{"npm"},
-			wantErr:     false,
+			name: "network none",
+			content: `presets:
+  test:
+    network: none`,
+			want: NetworkPolicy{None: true},
 		},
 		{
-			name:        "both exact and pattern match",
-			command:     "python",
-			wantPresets: []string{"python"},
-			wantErr:     false,
+			name: "network not set",
+			content: `presets:
+  test:
+    allow:
+      - /tmp`,
+			want: NetworkPolicy{},
 		},
 		{
-			name:        "pattern match python3",
-			command:     "python3",
-			wantPresets: []string{"python"},
-			wantErr:     false,
+			name: "allowed hosts",
+			content: `presets:
+  test:
+    network:
+      allow-hosts:
+        - registry.npmjs.org
+        - "*.github.com"`,
+			want: NetworkPolicy{AllowHosts: []string{"registry.npmjs.org", "*.github.com"}},
 		},
 		{
-			name:        "no match",
-			command:     "ls",
-			wantPresets: []string{},
-			wantErr:     false,
+			name: "unsupported value",
+			content: `presets:
+  test:
+    network: all`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "test.yaml")
+			os.WriteFile(configPath, []byte(tt.content), 0o644)
+
+			config, err := loadConfig(configPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			preset, ok := config.GetPreset("test")
+			if !ok {
+				t.Fatal("preset 'test' not found")
+			}
+			if !reflect.DeepEqual(preset.Network, tt.want) {
+				t.Errorf("Network = %+v, want %+v", preset.Network, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresetWithSyscalls(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  debugger:
+    syscalls:
+      allow:
+        - ptrace
+  strict:
+    syscalls:
+      deny:
+        - socket
+      action: kill
+  invalid:
+    syscalls:
+      action: abort`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	debugger, _ := config.GetPreset("debugger")
+	processed, err := debugger.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+	if !reflect.DeepEqual(processed.Syscalls.Allow, []string{"ptrace"}) {
+		t.Errorf("Syscalls.Allow = %v, want [ptrace]", processed.Syscalls.Allow)
+	}
+
+	strict, _ := config.GetPreset("strict")
+	processed, err = strict.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+	if !reflect.DeepEqual(processed.Syscalls.Deny, []string{"socket"}) {
+		t.Errorf("Syscalls.Deny = %v, want [socket]", processed.Syscalls.Deny)
+	}
+	if processed.Syscalls.Action != SyscallActionKill {
+		t.Errorf("Syscalls.Action = %q, want %q", processed.Syscalls.Action, SyscallActionKill)
+	}
+
+	invalid, _ := config.GetPreset("invalid")
+	if _, err := invalid.ProcessPreset(); err == nil {
+		t.Error("expected error for invalid syscalls action")
+	}
+}
+
+func TestPresetWithLimits(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  test:
+    limits:
+      as: 4G
+      cpu: 10m
+      nproc: 256
+  invalid:
+    limits:
+      fsize: huge`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	preset, _ := config.GetPreset("test")
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+	want := LimitsConfig{AS: "4G", CPU: "10m", NProc: "256"}
+	if processed.Limits != want {
+		t.Errorf("Limits = %+v, want %+v", processed.Limits, want)
+	}
+
+	invalid, _ := config.GetPreset("invalid")
+	if _, err := invalid.ProcessPreset(); err == nil {
+		t.Error("ProcessPreset() expected error for invalid limit")
+	}
+}
+
+func TestPresetWithEnv(t *testing.T) {
+	t.Setenv("TEST_DIR", "/test/directory")
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  test:
+    env:
+      clear-all: true
+      safe: true
+      allow:
+        - PATH
+        - "LC_*"
+      deny:
+        - "*_TOKEN"
+      set:
+        CACHE_DIR: "$TEST_DIR/cache"
+  invalid:
+    env:
+      deny:
+        - "[A-"`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	preset, _ := config.GetPreset("test")
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+	want := EnvConfig{
+		Allow:    []string{"PATH", "LC_*"},
+		Deny:     []string{"*_TOKEN"},
+		Set:      map[string]string{"CACHE_DIR": "/test/directory/cache"},
+		ClearAll: true,
+		Safe:     true,
+	}
+	if !reflect.DeepEqual(processed.Env, want) {
+		t.Errorf("Env = %+v, want %+v", processed.Env, want)
+	}
+
+	invalid, _ := config.GetPreset("invalid")
+	if _, err := invalid.ProcessPreset(); err == nil {
+		t.Error("ProcessPreset() expected error for invalid env pattern")
+	}
+}
+
+func TestPresetWithTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  test:
+    timeout: 10m
+  negative:
+    timeout: -1s`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	preset, _ := config.GetPreset("test")
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+	if processed.Timeout != 10*time.Minute {
+		t.Errorf("Timeout = %s, want 10m0s", processed.Timeout)
+	}
+
+	negative, _ := config.GetPreset("negative")
+	if _, err := negative.ProcessPreset(); err == nil {
+		t.Error("ProcessPreset() expected error for negative timeout")
+	}
+}
+
+func TestPresetWithWhen(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	otherOS := "windows"
+	if runtime.GOOS == otherOS {
+		otherOS = "linux"
+	}
+	content := `presets:
+  tmp:
+    allow:
+      - "/shared"
+      - path: "/current"
+        when:
+          os: [` + runtime.GOOS + `]
+      - path: "/other"
+        when:
+          os: [` + otherOS + `]
+    read:
+      - path: "/other-arch"
+        when: {arch: [wasm]}
+  other:
+    when:
+      os: [` + otherOS + `]
+    allow-git: true
+    allow:
+      - "/other"
+  invalid:
+    when:
+      os: [macos]`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	preset, _ := config.GetPreset("tmp")
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+	want := []AllowPath{{Path: "/shared"}, {Path: "/current"}}
+	if !reflect.DeepEqual(processed.Allow, want) {
+		t.Errorf("Allow = %v, want %v", processed.Allow, want)
+	}
+	if runtime.GOARCH != "wasm" && len(processed.Read) != 0 {
+		t.Errorf("Read = %v, want none", processed.Read)
+	}
+
+	other, _ := config.GetPreset("other")
+	processed, err = other.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+	if processed.AllowGit || len(processed.Allow) != 0 {
+		t.Errorf("ProcessPreset() = %+v, want an empty preset for another os", processed)
+	}
+
+	invalid, _ := config.GetPreset("invalid")
+	if _, err := invalid.ProcessPreset(); err == nil {
+		t.Error("ProcessPreset() expected error for unknown os")
+	}
+}
+
+func TestPresetWithPathTemplates(t *testing.T) {
+	tmpDir := t.TempDir()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", "")
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  templates:
+    allow:
+      - "~/.npm"
+      - "${XDG_CACHE_HOME}/npm"
+      - "${CAGE_TEST_UNSET:-$HOME/out}"
+    read:
+      - "${CAGE_CONFIG_DIR}/shared"
+  unset:
+    allow:
+      - "$CAGE_TEST_UNSET"
+  root:
+    allow:
+      - "${CAGE_TEST_UNSET:-}/"`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	preset, _ := config.GetPreset("templates")
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+	want := []AllowPath{
+		{Path: filepath.Join(home, ".npm")},
+		{Path: filepath.Join(home, ".cache", "npm")},
+		{Path: filepath.Join(home, "out")},
+	}
+	if !reflect.DeepEqual(processed.Allow, want) {
+		t.Errorf("Allow = %v, want %v", processed.Allow, want)
+	}
+	wantRead := []AllowPath{{Path: filepath.Join(tmpDir, "shared")}}
+	if !reflect.DeepEqual(processed.Read, wantRead) {
+		t.Errorf("Read = %v, want %v", processed.Read, wantRead)
+	}
+
+	for _, name := range []string{"unset", "root"} {
+		preset, _ := config.GetPreset(name)
+		if _, err := preset.ProcessPreset(); err == nil {
+			t.Errorf("ProcessPreset() expected error for preset '%s'", name)
+		}
+	}
+}
+
+func TestPresetWithExtends(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  base:
+    allow:
+      - "."
+  node:
+    extends: [base]
+    allow:
+      - "node_modules"`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	preset, _ := config.GetPreset("node")
+	if !reflect.DeepEqual(preset.Extends, []string{"base"}) {
+		t.Errorf("Extends = %v, want [base]", preset.Extends)
+	}
+	resolved, err := config.ResolvePresets([]string{"node"})
+	if err != nil {
+		t.Fatalf("ResolvePresets() error = %v", err)
+	}
+	if !reflect.DeepEqual(resolved, []string{"base", "node"}) {
+		t.Errorf("ResolvePresets() = %v, want [base node]", resolved)
+	}
+}
+
+func TestConfigResolvePresets(t *testing.T) {
+	config := &Config{
+		Presets: map[string]Preset{
+			"base":    {},
+			"npm":     {Extends: []string{"base"}},
+			"cache":   {},
+			"node":    {Extends: []string{"npm", "cache"}},
+			"pip":     {Extends: []string{"base"}},
+			"self":    {Extends: []string{"self"}},
+			"a":       {Extends: []string{"b"}},
+			"b":       {Extends: []string{"c"}},
+			"c":       {Extends: []string{"a"}},
+			"broken":  {Extends: []string{"missing"}},
+			"wrapper": {Extends: []string{"broken"}},
+			// elsewhere only applies on another machine
+			"elsewhere":        {Extends: []string{"npm"}, When: &Condition{OS: []string{"plan9"}}},
+			"elsewhere-cycle":  {Extends: []string{"elsewhere-parent"}, When: &Condition{OS: []string{"plan9"}}},
+			"elsewhere-parent": {Extends: []string{"elsewhere-cycle"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		presets []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "no extends",
+			presets: []string{"base", "cache"},
+			want:    []string{"base", "cache"},
+		},
+		{
+			name:    "parents first",
+			presets: []string{"node"},
+			want:    []string{"base", "npm", "cache", "node"},
+		},
+		{
+			name:    "shared parent applied once",
+			presets: []string{"node", "pip"},
+			want:    []string{"base", "npm", "cache", "node", "pip"},
+		},
+		{
+			name:    "preset given before its child",
+			presets: []string{"npm", "node", "npm"},
+			want:    []string{"base", "npm", "cache", "node"},
+		},
+		{
+			name:    "parents of a preset for another machine are left out",
+			presets: []string{"elsewhere", "cache"},
+			want:    []string{"cache"},
+		},
+		{
+			name:    "parents of a preset for another machine applied by another preset",
+			presets: []string{"elsewhere", "node"},
+			want:    []string{"base", "npm", "cache", "node"},
+		},
+		{
+			name:    "cycle through a preset for another machine",
+			presets: []string{"elsewhere-cycle"},
+			wantErr: "preset 'elsewhere-cycle' extends itself: elsewhere-cycle -> elsewhere-parent -> elsewhere-cycle",
+		},
+		{
+			name:    "extends itself",
+			presets: []string{"self"},
+			wantErr: "preset 'self' extends itself: self -> self",
+		},
+		{
+			name:    "cycle",
+			presets: []string{"a"},
+			wantErr: "preset 'a' extends itself: a -> b -> c -> a",
+		},
+		{
+			name:    "unknown parent",
+			presets: []string{"wrapper"},
+			wantErr: "preset 'broken' extends unknown preset 'missing'",
+		},
+		{
+			name:    "unknown preset",
+			presets: []string{"missing"},
+			wantErr: "preset 'missing' not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := config.ResolvePresets(tt.presets)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("ResolvePresets() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolvePresets() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolvePresets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresetWithInvalidPort(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "test.yaml")
+	content := `presets:
+  test:
+    connect:
+      - 70000`
+	os.WriteFile(configPath, []byte(content), 0o644)
+
+	if _, err := loadConfig(configPath); err == nil {
+		t.Error("expected error for out of range port")
+	}
+}
+
+func TestProcessPresetWithAllowGit(t *testing.T) {
+	// This test will only check the AllowGit flag is preserved
+	// We can't easily test the git directory addition without a real git repo
+	preset := Preset{
+		Allow: []AllowPath{
+			{Path: "$HOME/.npm"},
+			{Path: "/tmp"},
+		},
+		AllowKeychain: true,
+		AllowGit:      true,
+	}
+
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+
+	// Check that AllowGit is preserved
+	if processed.AllowGit != preset.AllowGit {
+		t.Errorf("ProcessPreset() AllowGit = %v, want %v", processed.AllowGit, preset.AllowGit)
+	}
+
+	// Check that AllowKeychain is preserved
+	if processed.AllowKeychain != preset.AllowKeychain {
+		t.Errorf(
+			"ProcessPreset() AllowKeychain = %v, want %v",
+			processed.AllowKeychain,
+			preset.AllowKeychain,
+		)
+	}
+
+	// Check that paths are expanded
+	expectedPaths := []string{
+		os.Getenv("HOME") + "/.npm",
+		"/tmp",
+	}
+
+	// The git directory might be added if we're in a git repo, but we can't control that in tests
+	// So we check that at least the expected paths are present
+	if len(processed.Allow) < len(expectedPaths) {
+		t.Errorf(
+			"ProcessPreset() returned %d paths, want at least %d",
+			len(processed.Allow),
+			len(expectedPaths),
+		)
+	}
+
+	for i, expected := range expectedPaths {
+		if processed.Allow[i].Path != expected {
+			t.Errorf("ProcessPreset() path[%d] = %v, want %v", i, processed.Allow[i].Path, expected)
+		}
+	}
+}
+
+func TestGetAutoPresets(t *testing.T) {
+	config := &Config{
+		Presets: map[string]Preset{
+			"claude-code": {Allow: []AllowPath{{Path: "/tmp"}}},
+			"npm":         {Allow: []AllowPath{{Path: "~/.npm"}}},
+			"python":      {Allow: []AllowPath{{Path: "~/.python"}}},
+		},
+		AutoPresets: []AutoPresetRule{
+			{
+				Command: "claude",
+				Presets: []string{"claude-code"},
+			},
+			{
+				CommandPattern: "^(npm|npx|yarn)$",
+				Presets:        []string{"npm"},
+			},
+			{
+				Command: "python",
+				Presets: []string{"python"},
+			},
+			{
+				CommandPattern: "^python[0-9]+$",
+				Presets:        []string{"python"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		command     string
+		wantPresets []string
+		wantErr     bool
+	}{
+		{
+			name:        "exact command match",
+			command:     "claude",
+			wantPresets: []string{"claude-code"},
+			wantErr:     false,
+		},
+		{
+			name:        "exact command match with path",
+			command:     "/usr/bin/claude",
+			wantPresets: []string{"claude-code"},
+			wantErr:     false,
+		},
+		{
+			name:        "regex pattern match npm",
+			command:     "npm",
+			wantPresets: []string{"npm"},
+			wantErr:     false,
+		},
+		{
+			name:        "regex pattern match npx",
+			command:     "npx",
+			wantPresets: []string{"npm"},
+			wantErr:     false,
+		},
+		{
+			name:        "regex pattern match yarn",
+			command:     "/usr/local/bin/yarn",
+			wantPresets: []string{"npm"},
+			wantErr:     false,
+		},
+		{
+			name:        "both exact and pattern match",
+			command:     "python",
+			wantPresets: []string{"python"},
+			wantErr:     false,
+		},
+		{
+			name:        "pattern match python3",
+			command:     "python3",
+			wantPresets: []string{"python"},
+			wantErr:     false,
+		},
+		{
+			name:        "no match",
+			command:     "ls",
+			wantPresets: []string{},
+			wantErr:     false,
 		},
 		{
 			name:        "no match with path",
@@ -523,6 +1300,240 @@ func TestGetAutoPresets(t *testing.T) {
 	}
 }
 
+func TestGetAutoPresetsConditions(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, "work", "project")
+	if err := os.MkdirAll(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(project)
+	t.Setenv("CAGE_TEST_ROOT", root)
+	t.Setenv("CAGE_TEST_CI", "true")
+
+	tests := []struct {
+		name    string
+		rule    AutoPresetRule
+		command string
+		args    []string
+		want    []string
+	}{
+		{
+			name:    "subcommand matches",
+			rule:    AutoPresetRule{Command: "git", Subcommand: "push", Presets: []string{"ssh"}},
+			command: "git",
+			args:    []string{"--no-pager", "push", "origin"},
+			want:    []string{"ssh"},
+		},
+		{
+			name:    "subcommand does not match",
+			rule:    AutoPresetRule{Command: "git", Subcommand: "push", Presets: []string{"ssh"}},
+			command: "git",
+			args:    []string{"status"},
+		},
+		{
+			name:    "args pattern matches",
+			rule:    AutoPresetRule{Command: "npm", ArgsPattern: `^(test|run test)\b`, Presets: []string{"test"}},
+			command: "npm",
+			args:    []string{"run", "test", "--", "-u"},
+			want:    []string{"test"},
+		},
+		{
+			name:    "command and args pattern must both match",
+			rule:    AutoPresetRule{Command: "yarn", ArgsPattern: `^test`, Presets: []string{"test"}},
+			command: "npm",
+			args:    []string{"test"},
+		},
+		{
+			name:    "cwd under",
+			rule:    AutoPresetRule{CwdUnder: "$CAGE_TEST_ROOT/work", Presets: []string{"work"}},
+			command: "make",
+			want:    []string{"work"},
+		},
+		{
+			name:    "cwd not under",
+			rule:    AutoPresetRule{CwdUnder: "$CAGE_TEST_ROOT/other", Presets: []string{"work"}},
+			command: "make",
+		},
+		{
+			name:    "cwd pattern",
+			rule:    AutoPresetRule{CwdPattern: `/project$`, Presets: []string{"project"}},
+			command: "make",
+			want:    []string{"project"},
+		},
+		{
+			name:    "env matches",
+			rule:    AutoPresetRule{Env: map[string]string{"CAGE_TEST_CI": "t*"}, Presets: []string{"ci"}},
+			command: "make",
+			want:    []string{"ci"},
+		},
+		{
+			name:    "env does not match",
+			rule:    AutoPresetRule{Env: map[string]string{"CAGE_TEST_CI": "false"}, Presets: []string{"ci"}},
+			command: "make",
+		},
+		{
+			name:    "env not set",
+			rule:    AutoPresetRule{Env: map[string]string{"CAGE_TEST_UNSET": "*"}, Presets: []string{"ci"}},
+			command: "make",
+		},
+		{
+			name:    "no conditions",
+			rule:    AutoPresetRule{Presets: []string{"all"}},
+			command: "make",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{AutoPresets: []AutoPresetRule{tt.rule}}
+			got, err := config.GetAutoPresets(tt.command, tt.args...)
+			if err != nil {
+				t.Fatalf("GetAutoPresets() error = %v", err)
+			}
+			if len(got) == 0 && len(tt.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAutoPresets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetAutoPresetsWhenFile(t *testing.T) {
+	root := t.TempDir()
+	// Directories with glob metacharacters are searched as they are
+	sub := filepath.Join(root, "app", "[id]")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(root, "Cargo.toml"), nil, 0o644)
+	os.WriteFile(filepath.Join(root, "app", "package.json"), nil, 0o644)
+	os.WriteFile(filepath.Join(root, "app", "tool.csproj"), nil, 0o644)
+	t.Chdir(sub)
+
+	config := &Config{
+		AutoPresets: []AutoPresetRule{
+			{WhenFile: "package.json", Presets: []string{"npm"}},
+			{WhenFile: "Cargo.toml", Presets: []string{"cargo"}},
+			{WhenFile: "go.mod", Presets: []string{"go"}},
+			{WhenFile: "*.csproj", Presets: []string{"dotnet"}},
+			{Command: "make", WhenFile: "Makefile", Presets: []string{"make"}},
+		},
+	}
+
+	got, err := config.GetAutoPresets("make")
+	if err != nil {
+		t.Fatalf("GetAutoPresets() error = %v", err)
+	}
+	if want := []string{"npm", "cargo", "dotnet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAutoPresets() = %v, want %v", got, want)
+	}
+
+	config.AutoPresets = []AutoPresetRule{{WhenFile: "[invalid", Presets: []string{"x"}}}
+	if _, err := config.GetAutoPresets("make"); err == nil {
+		t.Error("GetAutoPresets() expected error for invalid when-file pattern")
+	}
+}
+
+func TestGetAutoPresetsExcludePresets(t *testing.T) {
+	config := &Config{
+		AutoPresets: []AutoPresetRule{
+			{Command: "npm", Presets: []string{"npm", "network"}},
+			{Command: "npm", Subcommand: "publish", Presets: []string{"npm-publish"}, ExcludePresets: []string{"npm"}},
+		},
+	}
+
+	got, err := config.GetAutoPresets("npm", "install")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"npm", "network"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAutoPresets(npm install) = %v, want %v", got, want)
+	}
+
+	got, err = config.GetAutoPresets("npm", "publish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"network", "npm-publish"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAutoPresets(npm publish) = %v, want %v", got, want)
+	}
+}
+
+func TestConfigResolveCommandPresets(t *testing.T) {
+	config := &Config{
+		Presets: map[string]Preset{
+			"npm":          {},
+			"node":         {Extends: []string{"npm"}},
+			"npm-registry": {},
+		},
+		AutoPresets: []AutoPresetRule{
+			{Command: "npm", Presets: []string{"node"}},
+			{Command: "npm", Subcommand: "publish", Presets: []string{"npm-registry"}, ExcludePresets: []string{"npm"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		presets []string
+		args    []string
+		want    []string
+	}{
+		{name: "inherited preset", args: []string{"install"}, want: []string{"npm", "node"}},
+		{name: "excluded inherited preset", args: []string{"publish"}, want: []string{"node", "npm-registry"}},
+		{name: "explicit preset is kept", presets: []string{"npm"}, args: []string{"publish"}, want: []string{"npm", "node", "npm-registry"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := config.ResolveCommandPresets(tt.presets, "npm", tt.args...)
+			if err != nil {
+				t.Fatalf("ResolveCommandPresets() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveCommandPresets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProjectInteractivePreset(t *testing.T) {
+	tmpDir := t.TempDir()
+	project := filepath.Join(tmpDir, ".cage.yaml")
+	other := filepath.Join(tmpDir, "other.yaml")
+	data := []byte("presets:\n  interactive:\n    allow: [\"/tmp\"]\n")
+	if err := os.WriteFile(other, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		files []configFile
+		want  []string
+	}{
+		{name: "trusted project configuration", files: []configFile{{path: project, data: data}}, want: []string{"interactive"}},
+		{name: "other configuration", files: []configFile{{path: other}}, want: nil},
+		{name: "replaced by a later configuration", files: []configFile{{path: project, data: data}, {path: other}}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := loadConfigFiles(tt.files)
+			if err != nil {
+				t.Fatalf("loadConfigFiles() error = %v", err)
+			}
+			got, err := config.ResolveCommandPresets(nil, "make")
+			if err != nil {
+				t.Fatalf("ResolveCommandPresets() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveCommandPresets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGetAutoPresetsInvalidRegex(t *testing.T) {
 	config := &Config{
 		AutoPresets: []AutoPresetRule{
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// runConfig implements the config subcommand
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: cage config show|validate|trust|untrust")
+	}
+	switch args[0] {
+	case "show":
+		return runConfigShow(args[1:])
+	case "validate":
+		return runConfigValidate(args[1:])
+	case "trust":
+		return runConfigTrust(args[1:], true)
+	case "untrust":
+		return runConfigTrust(args[1:], false)
+	}
+	return fmt.Errorf("unknown config command %q", args[0])
+}
+
+// runConfigShow prints the configuration merged from all configuration files
+func runConfigShow(args []string) error {
+	fs := flag.NewFlagSet("config show", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cage config show [flags]\n")
+		fs.PrintDefaults()
+	}
+	var configFlags arrayFlags
+	fs.Var(&configFlags, "config", "Path to a configuration file merged over the system and user configuration (can be used multiple times)")
+	origin := fs.Bool("origin", false, "Show the file each preset, preset setting and auto-preset rule was loaded from")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	config, err := loadConfigFiles(configFiles(configFlags))
+	if err != nil {
+		return err
+	}
+	return writeConfig(os.Stdout, config, *origin)
+}
+
+// runConfigValidate checks configuration files strictly and prints the problems found
+// Without file arguments, the files merged into the configuration are checked
+func runConfigValidate(args []string) error {
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cage config validate [flags] [file...]\n")
+		fs.PrintDefaults()
+	}
+	var configFlags arrayFlags
+	fs.Var(&configFlags, "config", "Path to a configuration file merged over the system and user configuration (can be used multiple times)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = configPaths(configFlags)
+	}
+	problems, err := validateConfig(paths)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	switch len(problems) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("1 problem found")
+	}
+	return fmt.Errorf("%d problems found", len(problems))
+}
+
+// runConfigTrust trusts or untrusts a project configuration file,
+// by default the nearest .cage.yaml in the working directory or its parents
+func runConfigTrust(args []string, trust bool) error {
+	var path string
+	switch len(args) {
+	case 0:
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("get working directory: %w", err)
+		}
+		found, ok := findProjectConfig(cwd)
+		if !ok {
+			return fmt.Errorf("no %s found in %s or its parents", projectConfigName, cwd)
+		}
+		path = found
+	case 1:
+		path = args[0]
+	default:
+		return fmt.Errorf("usage: cage config trust|untrust [path]")
+	}
+
+	if !trust {
+		if err := untrustConfig(path); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "cage: %s is no longer trusted\n", path)
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// Check that the file can be loaded, so that it is not trusted with mistakes
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("error loading config from %s: %w", path, err)
+	}
+	if err := trustConfig(path, data); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "cage: trusted %s\n", path)
+	return nil
+}
+
+// writeConfig prints a merged configuration as YAML
+// Presets are printed as they were written in their configuration file
+// With origin, comments show the loaded files, the file each preset and rule was loaded from,
+// and the files the settings of each preset come from, including the presets it extends
+func writeConfig(w io.Writer, config *Config, origin bool) error {
+	if origin {
+		if len(config.files) == 0 {
+			fmt.Fprintln(w, "# No configuration files were found")
+		} else {
+			fmt.Fprintln(w, "# Configuration files, in the order they are merged:")
+			for _, file := range config.files {
+				fmt.Fprintf(w, "#   %s\n", file)
+			}
+		}
+	}
+
+	names := config.ListPresets()
+	slices.Sort(names)
+	sources := map[string]yaml.MapSlice{}
+	// source returns a preset as it was written in its configuration file
+	source := func(name string) (any, error) {
+		file := config.presetOrigins[name]
+		if _, ok := sources[file]; !ok {
+			presets, err := presetSources(file)
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", file, err)
+			}
+			sources[file] = presets
+		}
+		var value any
+		for _, item := range sources[file] {
+			if fmt.Sprint(item.Key) == name {
+				value = item.Value
+			}
+		}
+		return value, nil
+	}
+
+	if len(names) == 0 {
+		fmt.Fprintln(w, "presets: {}")
+	} else {
+		fmt.Fprintln(w, "presets:")
+	}
+	for _, name := range names {
+		value, err := source(name)
+		if err != nil {
+			return err
+		}
+
+		if origin {
+			file := config.presetOrigins[name]
+			if replaced := config.replacedPresetOrigins[name]; len(replaced) > 0 {
+				fmt.Fprintf(w, "  # %s, replacing the preset in %s\n", file, strings.Join(replaced, ", "))
+			} else {
+				fmt.Fprintf(w, "  # %s\n", file)
+			}
+			settings, err := settingOrigins(config, name, source)
+			if err != nil {
+				return err
+			}
+			for _, setting := range settings {
+				fmt.Fprintf(w, "  #   %s\n", setting)
+			}
+		}
+		b, err := yaml.Marshal(yaml.MapSlice{{Key: name, Value: value}})
+		if err != nil {
+			return err
+		}
+		writeIndented(w, string(b), "  ")
+	}
+
+	if len(config.AutoPresets) == 0 {
+		return nil
+	}
+	fmt.Fprintln(w, "auto-presets:")
+	for i, rule := range config.AutoPresets {
+		if origin {
+			fmt.Fprintf(w, "  # %s\n", config.autoPresetOrigins[i])
+		}
+		b, err := yaml.Marshal([]AutoPresetRule{rule})
+		if err != nil {
+			return err
+		}
+		writeIndented(w, string(b), "  ")
+	}
+	return nil
+}
+
+// settingOrigins describes the files the settings of a preset come from, one line per setting,
+// including the settings of the presets it extends, which are applied with it
+func settingOrigins(config *Config, name string, source func(name string) (any, error)) ([]string, error) {
+	chain, err := config.ResolvePresets([]string{name})
+	if err != nil || !slices.Contains(chain, name) {
+		// Presets that cannot be applied only show their own settings
+		chain = []string{name}
+	}
+
+	var keys []string
+	origins := map[string][]string{}
+	for _, preset := range chain {
+		value, err := source(preset)
+		if err != nil {
+			return nil, err
+		}
+		settings, _ := value.(yaml.MapSlice)
+		for _, item := range settings {
+			key := fmt.Sprint(item.Key)
+			if _, ok := origins[key]; !ok {
+				keys = append(keys, key)
+			}
+			from := config.presetOrigins[preset]
+			if preset != name {
+				from += " (" + preset + ")"
+			}
+			origins[key] = append(origins[key], from)
+		}
+	}
+
+	lines := make([]string, len(keys))
+	for i, key := range keys {
+		lines[i] = key + ": " + strings.Join(origins[key], ", ")
+	}
+	return lines, nil
+}
+
+// presetSources reads the presets of a configuration file as they were written, keeping the order of keys
+func presetSources(path string) (yaml.MapSlice, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Presets yaml.MapSlice `yaml:"presets"`
+	}
+	if err := yaml.UnmarshalWithOptions(data, &file, yaml.UseOrderedMap()); err != nil {
+		return nil, err
+	}
+	return file.Presets, nil
+}
+
+// writeIndented writes the lines of s with a prefix
+func writeIndented(w io.Writer, s, prefix string) {
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		fmt.Fprintf(w, "%s%s\n", prefix, line)
+	}
+}
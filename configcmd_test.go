@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	userPath := filepath.Join(tmpDir, "user.yaml")
+	os.WriteFile(userPath, []byte(`presets:
+  npm:
+    allow:
+      - "$HOME/.npm"
+    allow-git: true
+  base:
+    allow: ["."]
+`), 0o644)
+	projectPath := filepath.Join(tmpDir, "project.yaml")
+	os.WriteFile(projectPath, []byte(`presets:
+  npm:
+    extends: [base]
+  team:
+    extends: [npm]
+    allow-git: true
+auto-presets:
+  - command: npm
+    presets: [npm]
+`), 0o644)
+
+	config, err := loadConfig(userPath, projectPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		origin bool
+		want   string
+	}{
+		{
+			name: "without origin",
+			want: `presets:
+  base:
+    allow:
+    - .
+  npm:
+    extends:
+    - base
+  team:
+    extends:
+    - npm
+    allow-git: true
+auto-presets:
+  - command: npm
+    presets:
+    - npm
+`,
+		},
+		{
+			name:   "with origin",
+			origin: true,
+			want: `# Configuration files, in the order they are merged:
+#   ` + userPath + `
+#   ` + projectPath + `
+presets:
+  # ` + userPath + `
+  #   allow: ` + userPath + `
+  base:
+    allow:
+    - .
+  # ` + projectPath + `, replacing the preset in ` + userPath + `
+  #   allow: ` + userPath + ` (base)
+  #   extends: ` + projectPath + `
+  npm:
+    extends:
+    - base
+  # ` + projectPath + `
+  #   allow: ` + userPath + ` (base)
+  #   extends: ` + projectPath + ` (npm), ` + projectPath + `
+  #   allow-git: ` + projectPath + `
+  team:
+    extends:
+    - npm
+    allow-git: true
+auto-presets:
+  # ` + projectPath + `
+  - command: npm
+    presets:
+    - npm
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := writeConfig(&b, config, tt.origin); err != nil {
+				t.Fatalf("writeConfig() error = %v", err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("writeConfig() =\n%s\nwant:\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
@@ -5,7 +5,7 @@ pkgs.buildGoLatestModule {
   pname = "cage";
   version = "0.1.13";
   src = ./.;
-  vendorHash = "sha256-EnEy9KELRFyM+uB1h9mCxuDeUirFiuoLnHURkg8/oQs=";
+  vendorHash = "sha256-L3Dl6oUA/sDWB1t/yDE7KXg7gev7QMz8ePrfxFW9rt0=";
   meta = {
     mainProgram = "cage";
   };
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 )
 
 // printDryRunAndExit displays the dry-run information and exits
@@ -14,3 +17,67 @@ func printDryRunAndExit(config *SandboxConfig) {
 	}
 	os.Exit(0)
 }
+
+// printPorts lists TCP ports for the dry-run output
+func printPorts(ports []uint16) {
+	if len(ports) == 0 {
+		fmt.Println("  * (none)")
+		return
+	}
+	for _, port := range ports {
+		fmt.Printf("  * %d\n", port)
+	}
+}
+
+// printResourceLimits prints the resource limits for the dry-run output
+func printResourceLimits(limits ResourceLimits) {
+	if !limits.IsSet() {
+		return
+	}
+	fmt.Println("- Resource limits:")
+	for _, limit := range limits.entries() {
+		if limit.value == nil {
+			continue
+		}
+		if limit.unit == "" {
+			fmt.Printf("  * %s: %d\n", limit.name, *limit.value)
+		} else {
+			fmt.Printf("  * %s: %d %s\n", limit.name, *limit.value, limit.unit)
+		}
+	}
+}
+
+// printEnvironment prints the environment variables that would be removed or set
+// Values are not printed because they may contain secrets
+func printEnvironment(config *SandboxConfig) {
+	if !config.Env.IsSet() {
+		return
+	}
+	kept := make(map[string]bool)
+	for _, kv := range config.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		kept[name] = true
+	}
+	var removed []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if !kept[name] {
+			removed = append(removed, name)
+		}
+	}
+	slices.Sort(removed)
+
+	fmt.Println("- Remove environment variables:")
+	if len(removed) == 0 {
+		fmt.Println("  * (none)")
+	}
+	for _, name := range removed {
+		fmt.Printf("  * %s\n", name)
+	}
+	if len(config.Env.Set) > 0 {
+		fmt.Println("- Set environment variables:")
+		for _, name := range slices.Sorted(maps.Keys(config.Env.Set)) {
+			fmt.Printf("  * %s\n", name)
+		}
+	}
+}
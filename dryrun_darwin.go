@@ -21,6 +21,21 @@ func showDryRun(config *SandboxConfig) error {
 		fmt.Println("- Allow all operations (-allow-all flag)")
 	} else {
 		fmt.Println("- Allow all operations by default")
+		if config.RestrictReads() {
+			fmt.Println("- Deny file reads except to:")
+			fmt.Println("  * System frameworks, libraries and configuration (built-in)")
+			fmt.Println("  * System temporary directories")
+			for _, path := range config.ReadPaths {
+				fmt.Printf("  * %s (user specified)\n", path)
+			}
+			fmt.Println("  * paths with write access")
+		}
+		if config.RestrictExec() {
+			fmt.Println("- Deny execution except under:")
+			for _, path := range config.ExecPaths {
+				fmt.Printf("  * %s (user specified)\n", path)
+			}
+		}
 		fmt.Println("- Deny all file writes")
 		fmt.Println("- Allow writes to:")
 		fmt.Println("  * System temporary directories")
@@ -41,6 +56,42 @@ func showDryRun(config *SandboxConfig) error {
 			}
 			fmt.Printf("  * %s (%s)\n", absPath, source)
 		}
+
+		if config.NoNetwork || config.RestrictHosts() {
+			fmt.Println("- Deny all network access except localhost and Unix sockets")
+		}
+		if config.RestrictHosts() {
+			fmt.Println("- Deny network access except HTTP(S) through the built-in proxy to hosts:")
+			for _, host := range config.AllowHosts {
+				fmt.Printf("  * %s\n", host)
+			}
+		}
+		if config.RestrictNetwork() || config.RestrictHosts() {
+			if config.RestrictHosts() {
+				fmt.Println("- Deny outgoing TCP connections except to localhost ports:")
+			} else {
+				fmt.Println("- Deny outgoing TCP connections except to ports:")
+			}
+			if config.RestrictHosts() {
+				fmt.Println("  * the built-in proxy")
+			}
+			if len(config.AllowConnect) > 0 || !config.RestrictHosts() {
+				printPorts(config.AllowConnect)
+			}
+			fmt.Println("- Deny binding TCP sockets except to ports:")
+			printPorts(config.AllowBind)
+		}
+		if config.ScopeSignals {
+			fmt.Println("- Deny signals to processes outside the sandbox")
+		}
+		printResourceLimits(config.Limits)
+		printEnvironment(config)
+		if config.Supervise {
+			fmt.Println("- Run the command as a child process of cage (-supervise)")
+		}
+		if config.Timeout > 0 {
+			fmt.Printf("- Terminate the command after %s\n", config.Timeout)
+		}
 	}
 
 	fmt.Println()
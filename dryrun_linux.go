@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 )
@@ -14,6 +15,8 @@ func showDryRun(config *SandboxConfig) error {
 	fmt.Println("========================================")
 	fmt.Println("Platform: Linux")
 	fmt.Println("Technology: Landlock LSM")
+	abi := landlockABIVersion()
+	fmt.Printf("Kernel Landlock ABI: %d\n", abi)
 	fmt.Println()
 	fmt.Println("The following restrictions would be applied:")
 	fmt.Println()
@@ -22,7 +25,33 @@ func showDryRun(config *SandboxConfig) error {
 	if config.AllowAll {
 		fmt.Println("- Allow all operations (-allow-all flag)")
 	} else {
-		fmt.Println("- Allow read access to all files")
+		if config.RestrictReads() {
+			fmt.Println("- Deny read access except to:")
+			for _, path := range systemReadPaths {
+				if _, err := os.Stat(path); err == nil {
+					fmt.Printf("  * %s (built-in)\n", path)
+				}
+			}
+			fmt.Printf("  * %s (command)\n", config.Command)
+			for _, path := range config.ReadPaths {
+				fmt.Printf("  * %s (user specified)\n", path)
+			}
+			fmt.Println("  * paths with write access")
+		} else {
+			fmt.Println("- Allow read access to all files")
+		}
+		if config.RestrictExec() {
+			fmt.Println("- Deny execution except under:")
+			for _, path := range systemExecPaths {
+				if _, err := os.Stat(path); err == nil {
+					fmt.Printf("  * %s (built-in)\n", path)
+				}
+			}
+			for _, path := range config.ExecPaths {
+				fmt.Printf("  * %s (user specified)\n", path)
+			}
+		}
+
 		fmt.Println("- Deny write access except to:")
 		fmt.Println("  * /dev/null (for discarding output)")
 
@@ -36,8 +65,86 @@ func showDryRun(config *SandboxConfig) error {
 			if config.AllowGit && strings.Contains(path, ".git") {
 				source = "-allow-git"
 			}
+			if kind, ok := config.CreatePaths[absPath]; ok {
+				source += ", " + kind + " created if missing"
+			}
 			fmt.Printf("  * %s (%s)\n", absPath, source)
 		}
+
+		if config.NoNetwork || config.RestrictHosts() {
+			fmt.Println("- Deny all network access except loopback (private network namespace)")
+		}
+		if config.RestrictHosts() {
+			fmt.Println("- Deny network access except HTTP(S) through the built-in proxy to hosts:")
+			for _, host := range config.AllowHosts {
+				fmt.Printf("  * %s\n", host)
+			}
+		}
+		if config.RestrictNetwork() {
+			fmt.Println("- Deny outgoing TCP connections except to ports:")
+			if config.RestrictHosts() {
+				fmt.Println("  * the built-in proxy")
+			}
+			if len(config.AllowConnect) > 0 || !config.RestrictHosts() {
+				printPorts(config.AllowConnect)
+			}
+			fmt.Println("- Deny binding TCP sockets except to ports:")
+			printPorts(config.AllowBind)
+		} else if !config.NoNetwork && !config.RestrictHosts() {
+			fmt.Println("- Allow all network access")
+		}
+		if config.ScopeSignals {
+			fmt.Println("- Deny signals to processes outside the sandbox")
+		}
+		if config.ScopeAbstractSockets {
+			fmt.Println("- Deny connections to abstract Unix sockets outside the sandbox")
+		}
+
+		printResourceLimits(config.Limits)
+		printEnvironment(config)
+		if config.Supervise {
+			fmt.Println("- Run the command as a child process of cage (-supervise)")
+		}
+		if config.Timeout > 0 {
+			fmt.Printf("- Terminate the command after %s\n", config.Timeout)
+		}
+		if config.Interactive {
+			fmt.Println("- Ask on the terminal before allowing writes outside the allowed paths (-interactive)")
+		}
+		if config.UseCgroup {
+			printCgroupLimits(config.CgroupLimits)
+		}
+
+		denied, err := deniedSyscalls(config)
+		if err != nil {
+			return err
+		}
+		action := "fail with EPERM"
+		if config.KillOnDeniedSyscall {
+			action = "kill the process"
+		}
+		fmt.Printf("- Deny system calls (seccomp, %s):\n", action)
+		for _, name := range denied {
+			fmt.Printf("  * %s\n", name)
+		}
+	}
+
+	if !config.AllowAll {
+		if abi < config.MinABI {
+			fmt.Println()
+			fmt.Printf("The command would not run: Landlock ABI %d is required\n", config.MinABI)
+		}
+		if unsupported := unsupportedLandlockFeatures(config, abi); len(unsupported) > 0 {
+			fmt.Println()
+			if config.Strict {
+				fmt.Println("The command would not run (-strict): the kernel cannot enforce:")
+			} else {
+				fmt.Println("Not enforced by this kernel:")
+			}
+			for _, feature := range unsupported {
+				fmt.Printf("- %s (requires ABI %d)\n", feature.name, feature.abi)
+			}
+		}
 	}
 
 	fmt.Println()
@@ -49,3 +156,24 @@ func showDryRun(config *SandboxConfig) error {
 
 	return nil
 }
+
+// printCgroupLimits prints the cgroup limits for the dry-run output
+func printCgroupLimits(limits CgroupLimits) {
+	fmt.Println("- Run in a new cgroup and report peak memory and CPU usage, with limits:")
+	if !limits.IsSet() {
+		fmt.Println("  * (none)")
+		return
+	}
+	if limits.MemoryMax != nil {
+		fmt.Printf("  * memory.max: %d bytes\n", *limits.MemoryMax)
+	}
+	if limits.PidsMax != nil {
+		fmt.Printf("  * pids.max: %d\n", *limits.PidsMax)
+	}
+	if limits.CPUMax != nil {
+		fmt.Printf("  * cpu.max: %s\n", limits.CPUMax)
+	}
+	for _, line := range limits.IOMax {
+		fmt.Printf("  * io.max: %s\n", line)
+	}
+}
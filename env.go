@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+// secretEnvPatterns are glob patterns of environment variables that commonly hold credentials
+// They are removed in the safe environment mode, and match names case-insensitively
+var secretEnvPatterns = []string{
+	"*TOKEN*",
+	"*SECRET*",
+	"*PASSWORD*",
+	"*PASSWD*",
+	"*CREDENTIAL*",
+	"*API_KEY*",
+	"*APIKEY*",
+	"*ACCESS_KEY*",
+	"*PRIVATE_KEY*",
+	"SSH_AUTH_SOCK",
+	"SSH_AGENT_PID",
+	"GPG_AGENT_INFO",
+	"GOOGLE_APPLICATION_CREDENTIALS",
+	"DATABASE_URL",
+}
+
+// EnvConfig configures the environment variables passed to the command
+type EnvConfig struct {
+	// Allow are glob patterns of variables that are always passed to the command
+	// They take precedence over Deny, ClearAll and Safe
+	Allow []string `yaml:"allow"`
+	// Deny are glob patterns of variables removed from the environment
+	Deny []string `yaml:"deny"`
+	// Set are variables set in the environment, overriding existing values
+	Set map[string]string `yaml:"set"`
+	// ClearAll removes all variables except allowed and set ones
+	ClearAll bool `yaml:"clear-all"`
+	// Safe removes variables matching the built-in secret patterns
+	Safe bool `yaml:"safe"`
+}
+
+// Validate checks the patterns and variable names
+func (e EnvConfig) Validate() error {
+	for _, pattern := range slices.Concat(e.Allow, e.Deny) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid env pattern %q: %w", pattern, err)
+		}
+	}
+	for name := range e.Set {
+		if name == "" || strings.Contains(name, "=") {
+			return fmt.Errorf("invalid env variable name %q", name)
+		}
+	}
+	return nil
+}
+
+// Merge returns the configuration combined with other
+// Patterns are appended, booleans are ORed and variables set in other take precedence
+func (e EnvConfig) Merge(other EnvConfig) EnvConfig {
+	set := maps.Clone(e.Set)
+	if len(other.Set) > 0 && set == nil {
+		set = make(map[string]string, len(other.Set))
+	}
+	maps.Copy(set, other.Set)
+	return EnvConfig{
+		Allow:    slices.Concat(e.Allow, other.Allow),
+		Deny:     slices.Concat(e.Deny, other.Deny),
+		Set:      set,
+		ClearAll: e.ClearAll || other.ClearAll,
+		Safe:     e.Safe || other.Safe,
+	}
+}
+
+// IsSet reports whether the configuration changes the environment
+func (e EnvConfig) IsSet() bool {
+	return len(e.Deny) > 0 || len(e.Set) > 0 || e.ClearAll || e.Safe
+}
+
+// Apply returns environ filtered by the configuration, with the configured variables set
+// Variables set by cage itself are always kept
+func (e EnvConfig) Apply(environ []string) []string {
+	var result []string
+	for _, kv := range environ {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := e.Set[name]; ok {
+			continue
+		}
+		if slices.Contains(cageEnvVars, name) || e.allowed(name) {
+			result = append(result, kv)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(e.Set)) {
+		result = append(result, name+"="+e.Set[name])
+	}
+	return result
+}
+
+// allowed reports whether a variable from the current environment is passed to the command
+func (e EnvConfig) allowed(name string) bool {
+	if matchEnvPattern(e.Allow, name, false) {
+		return true
+	}
+	if e.ClearAll || matchEnvPattern(e.Deny, name, false) {
+		return false
+	}
+	return !e.Safe || !matchEnvPattern(secretEnvPatterns, name, true)
+}
+
+// matchEnvPattern reports whether name matches one of the glob patterns
+func matchEnvPattern(patterns []string, name string, ignoreCase bool) bool {
+	if ignoreCase {
+		name = strings.ToUpper(name)
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvConfigApply(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/user",
+		"LANG=C.UTF-8",
+		"LC_ALL=C",
+		"GITHUB_TOKEN=ghp_secret",
+		"AWS_SECRET_ACCESS_KEY=secret",
+		"npm_config_password=secret",
+		"SSH_AUTH_SOCK=/tmp/agent.sock",
+		"IN_CAGE=1",
+	}
+
+	tests := []struct {
+		name string
+		env  EnvConfig
+		want []string
+	}{
+		{
+			name: "empty config keeps everything",
+			env:  EnvConfig{},
+			want: environ,
+		},
+		{
+			name: "safe removes secrets",
+			env:  EnvConfig{Safe: true},
+			want: []string{"PATH=/usr/bin", "HOME=/home/user", "LANG=C.UTF-8", "LC_ALL=C", "IN_CAGE=1"},
+		},
+		{
+			name: "allow takes precedence over safe",
+			env:  EnvConfig{Safe: true, Allow: []string{"GITHUB_TOKEN"}},
+			want: []string{"PATH=/usr/bin", "HOME=/home/user", "LANG=C.UTF-8", "LC_ALL=C", "GITHUB_TOKEN=ghp_secret", "IN_CAGE=1"},
+		},
+		{
+			name: "deny patterns",
+			env:  EnvConfig{Deny: []string{"LC_*", "*_TOKEN", "SSH_AUTH_SOCK"}},
+			want: []string{"PATH=/usr/bin", "HOME=/home/user", "LANG=C.UTF-8", "AWS_SECRET_ACCESS_KEY=secret", "npm_config_password=secret", "IN_CAGE=1"},
+		},
+		{
+			name: "clear all keeps allowed variables and IN_CAGE",
+			env:  EnvConfig{ClearAll: true, Allow: []string{"PATH", "L*"}},
+			want: []string{"PATH=/usr/bin", "LANG=C.UTF-8", "LC_ALL=C", "IN_CAGE=1"},
+		},
+		{
+			name: "set overrides and adds variables",
+			env: EnvConfig{
+				ClearAll: true,
+				Set:      map[string]string{"HOME": "/tmp/home", "CI": "true"},
+			},
+			want: []string{"IN_CAGE=1", "CI=true", "HOME=/tmp/home"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.env.Apply(environ)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvConfigMerge(t *testing.T) {
+	a := EnvConfig{
+		Deny: []string{"FOO"},
+		Set:  map[string]string{"A": "1", "B": "1"},
+	}
+	b := EnvConfig{
+		Allow:    []string{"PATH"},
+		Deny:     []string{"BAR"},
+		Set:      map[string]string{"B": "2"},
+		ClearAll: true,
+	}
+
+	want := EnvConfig{
+		Allow:    []string{"PATH"},
+		Deny:     []string{"FOO", "BAR"},
+		Set:      map[string]string{"A": "1", "B": "2"},
+		ClearAll: true,
+	}
+	if got := a.Merge(b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Merge() = %+v, want %+v", got, want)
+	}
+	if a.Set["B"] != "1" {
+		t.Errorf("Merge() modified the receiver: %v", a.Set)
+	}
+}
+
+func TestEnvConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     EnvConfig
+		wantErr bool
+	}{
+		{name: "valid", env: EnvConfig{Allow: []string{"LC_*"}, Set: map[string]string{"CI": "1"}}},
+		{name: "invalid pattern", env: EnvConfig{Deny: []string{"[A-"}}, wantErr: true},
+		{name: "empty name", env: EnvConfig{Set: map[string]string{"": "1"}}, wantErr: true},
+		{name: "name with equals sign", env: EnvConfig{Set: map[string]string{"A=B": "1"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.env.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
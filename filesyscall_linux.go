@@ -0,0 +1,232 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileSyscall describes a system call that modifies files
+type fileSyscall struct {
+	name string
+	// paths are the path arguments of the system call
+	paths []pathArg
+	// flags is the index of the open flags argument, or -1 if there is none
+	flags int
+	// openHow is set if the flags argument points to a struct open_how
+	openHow bool
+	// follow is set if a symbolic link in the last path component is followed
+	follow bool
+	// creates is the kind of entry the system call creates, AllowCreateFile or AllowCreateDirectory,
+	// or empty if it creates other entries or none
+	creates string
+}
+
+// pathArg describes a path argument of a system call
+type pathArg struct {
+	// dirfd is the index of the directory file descriptor argument, or -1 if there is none
+	dirfd int
+	// path is the index of the path argument
+	path int
+	// parent is set if the access is checked on the parent directory,
+	// like when an entry is created or removed
+	parent bool
+	// source is set if the path is not written, like the existing file of a hard link
+	source bool
+}
+
+// openWriteFlags are open flags that require write access
+const openWriteFlags = unix.O_WRONLY | unix.O_RDWR | unix.O_CREAT | unix.O_TRUNC
+
+// fileAccess is a call of a file system call that writes to files,
+// with the arguments read from the memory of the calling process
+type fileAccess struct {
+	fileSyscall
+	args [6]uint64
+	// how are the open flags, mode and resolve flags of open system calls
+	how unix.OpenHow
+	// paths are the absolute paths of the path arguments, in the order of fileSyscall.paths
+	// Symbolic links are resolved except in the last component of paths that are not followed
+	paths []string
+	// writes are the paths that need write access:
+	// the file itself, or its parent directory if an entry is created or removed
+	writes []string
+	// entries are the files written, in the order of writes
+	// They differ from writes if an entry is created or removed, where they are the entry itself
+	entries []string
+}
+
+// readFileAccess reads the arguments of a system call made by the process pid
+// It reports false if the system call does not write to files
+// Each argument is read only once, because the process may change its memory in the meantime
+func readFileAccess(pid int, nr uint64, args [6]uint64) (*fileAccess, bool) {
+	sc, ok := fileSyscalls[nr]
+	if !ok {
+		return nil, false
+	}
+	access := &fileAccess{fileSyscall: sc, args: args}
+
+	if sc.flags >= 0 {
+		if sc.openHow {
+			// struct open_how { __u64 flags; __u64 mode; __u64 resolve; }
+			b, err := readMemory(pid, uintptr(args[sc.flags]), 24)
+			if err != nil {
+				return nil, false
+			}
+			access.how = unix.OpenHow{
+				Flags:   binary.NativeEndian.Uint64(b[0:]),
+				Mode:    binary.NativeEndian.Uint64(b[8:]),
+				Resolve: binary.NativeEndian.Uint64(b[16:]),
+			}
+		} else {
+			// The mode follows the flags, both are of type int
+			access.how = unix.OpenHow{Flags: uint64(uint32(args[sc.flags])), Mode: uint64(uint32(args[sc.flags+1]))}
+		}
+		if access.how.Flags&openWriteFlags == 0 {
+			return nil, false
+		}
+	}
+	follow := sc.follow && access.how.Flags&unix.O_NOFOLLOW == 0
+
+	for _, arg := range sc.paths {
+		dirfd := unix.AT_FDCWD
+		if arg.dirfd >= 0 {
+			dirfd = int(int32(args[arg.dirfd]))
+		}
+		path, err := readPathArg(pid, dirfd, uintptr(args[arg.path]), follow, access.how.Resolve)
+		if err != nil {
+			return nil, false
+		}
+		access.paths = append(access.paths, path)
+		if arg.source {
+			continue
+		}
+
+		// Opening a file that does not exist creates it in its parent directory
+		parent := arg.parent
+		if sc.flags >= 0 {
+			_, err := os.Lstat(path)
+			parent = err != nil
+		}
+		access.entries = append(access.entries, path)
+		if parent {
+			path = filepath.Dir(path)
+		}
+		access.writes = append(access.writes, path)
+	}
+	return access, len(access.writes) > 0
+}
+
+// supportedResolveFlags are the resolve flags of openat2 that are checked on the absolute path
+const supportedResolveFlags = unix.RESOLVE_BENEATH | unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_SYMLINKS | unix.RESOLVE_NO_MAGICLINKS
+
+// readPathArg reads a path argument of a system call made by the process pid and makes it absolute
+// It returns an error if the path does not satisfy the resolve flags of openat2, or if they cannot be checked,
+// so that the kernel resolves the path itself
+func readPathArg(pid, dirfd int, addr uintptr, follow bool, resolve uint64) (string, error) {
+	arg, err := readString(pid, addr)
+	if err != nil {
+		return "", err
+	}
+	if arg == "" {
+		return "", fmt.Errorf("empty path")
+	}
+	path, err := resolvePath(pid, dirfd, arg)
+	if err != nil {
+		return "", err
+	}
+	real := realPath(path, follow)
+
+	if resolve&^supportedResolveFlags != 0 {
+		return "", fmt.Errorf("unsupported resolve flags %#x", resolve)
+	}
+	if resolve&(unix.RESOLVE_BENEATH|unix.RESOLVE_IN_ROOT) != 0 {
+		// Within the directory, RESOLVE_IN_ROOT resolves local paths like RESOLVE_BENEATH
+		dir, err := resolvePath(pid, dirfd, ".")
+		if err != nil {
+			return "", err
+		}
+		if !filepath.IsLocal(arg) || !isUnder(real, realPath(dir, true)) {
+			return "", fmt.Errorf("%s is not beneath %s", arg, dir)
+		}
+	}
+	if resolve&unix.RESOLVE_NO_SYMLINKS != 0 && real != path {
+		return "", fmt.Errorf("%s contains symbolic links", arg)
+	}
+	if resolve&unix.RESOLVE_NO_MAGICLINKS != 0 && isUnder(path, "/proc") {
+		return "", fmt.Errorf("%s may contain magic links", arg)
+	}
+	return real, nil
+}
+
+// resolvePath makes a path argument of a process absolute
+func resolvePath(pid, dirfd int, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
+	link := fmt.Sprintf("/proc/%d/cwd", pid)
+	if dirfd != unix.AT_FDCWD {
+		link = fmt.Sprintf("/proc/%d/fd/%d", pid, dirfd)
+	}
+	dir, err := os.Readlink(link)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, path), nil
+}
+
+// realPath resolves symbolic links in the parent directory of path,
+// and also in the last component if follow is set
+// Components that do not exist are kept as they are
+func realPath(path string, follow bool) string {
+	if follow {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return resolved
+		}
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		return filepath.Join(dir, filepath.Base(path))
+	}
+	return path
+}
+
+// readString reads a NUL-terminated string from the memory of a process
+func readString(pid int, addr uintptr) (string, error) {
+	var s []byte
+	for len(s) < unix.PathMax {
+		// Reads must not cross a page boundary, where the next page may not be mapped
+		n := os.Getpagesize() - int(addr%uintptr(os.Getpagesize()))
+		b, err := readMemory(pid, addr, n)
+		if err != nil {
+			return "", err
+		}
+		for i, c := range b {
+			if c == 0 {
+				return string(append(s, b[:i]...)), nil
+			}
+		}
+		s = append(s, b...)
+		addr += uintptr(n)
+	}
+	return "", fmt.Errorf("string at %#x is too long", addr)
+}
+
+// readMemory reads n bytes at addr from the memory of a process
+func readMemory(pid int, addr uintptr, n int) ([]byte, error) {
+	f, err := os.Open("/proc/" + strconv.Itoa(pid) + "/mem")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := make([]byte, n)
+	if _, err := f.ReadAt(b, int64(addr)); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
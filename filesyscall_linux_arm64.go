@@ -0,0 +1,41 @@
+//go:build linux && arm64
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// ntPRStatus is the register set of general purpose registers for PTRACE_GETREGSET
+const ntPRStatus = 1
+
+// fileSyscalls are the system calls that modify files, by system call number
+// arm64 only has the *at variants of most of them
+var fileSyscalls = map[uint64]fileSyscall{
+	unix.SYS_OPENAT:    {name: "openat", follow: true, paths: []pathArg{{dirfd: 0, path: 1}}, flags: 2, creates: AllowCreateFile},
+	unix.SYS_OPENAT2:   {name: "openat2", follow: true, paths: []pathArg{{dirfd: 0, path: 1}}, flags: 2, openHow: true, creates: AllowCreateFile},
+	unix.SYS_TRUNCATE:  {name: "truncate", follow: true, paths: []pathArg{{dirfd: -1, path: 0}}, flags: -1},
+	unix.SYS_MKDIRAT:   {name: "mkdirat", paths: []pathArg{{dirfd: 0, path: 1, parent: true}}, flags: -1, creates: AllowCreateDirectory},
+	unix.SYS_MKNODAT:   {name: "mknodat", paths: []pathArg{{dirfd: 0, path: 1, parent: true}}, flags: -1},
+	unix.SYS_UNLINKAT:  {name: "unlinkat", paths: []pathArg{{dirfd: 0, path: 1, parent: true}}, flags: -1},
+	unix.SYS_RENAMEAT:  {name: "renameat", paths: []pathArg{{dirfd: 0, path: 1, parent: true}, {dirfd: 2, path: 3, parent: true}}, flags: -1},
+	unix.SYS_RENAMEAT2: {name: "renameat2", paths: []pathArg{{dirfd: 0, path: 1, parent: true}, {dirfd: 2, path: 3, parent: true}}, flags: -1},
+	unix.SYS_LINKAT:    {name: "linkat", paths: []pathArg{{dirfd: 0, path: 1, source: true}, {dirfd: 2, path: 3, parent: true}}, flags: -1},
+	unix.SYS_SYMLINKAT: {name: "symlinkat", paths: []pathArg{{dirfd: 1, path: 2, parent: true}}, flags: -1},
+}
+
+// syscallRegs returns the system call number and arguments of a tracee stopped at system call entry
+func syscallRegs(pid int) (nr uint64, args [6]uint64, err error) {
+	var regs unix.PtraceRegsArm64
+	if err := unix.PtraceGetRegSetArm64(pid, ntPRStatus, &regs); err != nil {
+		return 0, args, err
+	}
+	return regs.Regs[8], [6]uint64(regs.Regs[0:6]), nil
+}
+
+// syscallReturn returns the return value of a tracee stopped at system call exit
+func syscallReturn(pid int) (int64, error) {
+	var regs unix.PtraceRegsArm64
+	if err := unix.PtraceGetRegSetArm64(pid, ntPRStatus, &regs); err != nil {
+		return 0, err
+	}
+	return int64(regs.Regs[0]), nil
+}
@@ -0,0 +1,19 @@
+//go:build linux && !amd64 && !arm64
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// fileSyscalls is empty because file system calls are not traced on this architecture
+var fileSyscalls = map[uint64]fileSyscall{}
+
+func syscallRegs(pid int) (nr uint64, args [6]uint64, err error) {
+	return 0, args, fmt.Errorf("learn mode is not supported on %s", runtime.GOARCH)
+}
+
+func syscallReturn(pid int) (int64, error) {
+	return 0, fmt.Errorf("learn mode is not supported on %s", runtime.GOARCH)
+}
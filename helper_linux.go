@@ -0,0 +1,280 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+
+	ll "github.com/landlock-lsm/go-landlock/landlock/syscall"
+	"golang.org/x/sys/unix"
+)
+
+// sandboxHelperName is the argv[0] used to re-execute cage as the helper process
+// that applies the restrictions and executes the command
+const sandboxHelperName = "cage-sandbox-helper"
+
+// sandboxConfigFD is the file descriptor on which the helper process receives the sandbox configuration
+// It is the first entry of exec.Cmd.ExtraFiles
+const sandboxConfigFD = 3
+
+// proxySocketFD is the file descriptor on which the helper process sends the listener of the egress proxy
+const proxySocketFD = 5
+
+// proxyPort is the port the egress proxy listens on in the network namespace of the command
+// The namespace is new, so the port is always free
+const proxyPort = 3128
+
+func init() {
+	// The helper process is cage itself, started by runInHelper
+	if len(os.Args) > 0 && os.Args[0] == sandboxHelperName {
+		if err := runSandboxHelper(); err != nil {
+			fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// runInHelper runs the command in a helper process instead of replacing the current process
+// This is needed when cage has to set up a new network namespace or cgroup for the command,
+// serve the egress proxy while the command runs, or supervise the command
+// It waits for the command and exits with the same status
+func runInHelper(config *SandboxConfig) error {
+	cmd, sendConfig, err := newHelperCommand(config)
+	if err != nil {
+		return err
+	}
+	sv := newSupervisor(cmd)
+	sv.SetTimeout(config.Timeout)
+
+	if !config.AllowAll && config.RestrictHosts() {
+		// The command runs in a private network namespace, where the proxy is the only way out
+		// The helper listens on the loopback interface of the namespace and passes the listener to cage,
+		// which connects to the allowed hosts from the network namespace of the user
+		fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("create socket pair: %w", err)
+		}
+		socket := os.NewFile(uintptr(fds[0]), "proxy-socket")
+		helperSocket := os.NewFile(uintptr(fds[1]), "proxy-socket-helper")
+		setExtraFile(cmd, proxySocketFD, helperSocket)
+
+		proxy := newEgressProxy(config.AllowHosts, os.Stderr)
+		sv.AfterExit(func(*os.ProcessState) { proxy.Close() })
+		sv.AfterStart(func() error {
+			helperSocket.Close()
+			go func() {
+				defer socket.Close()
+				fd, err := receiveFD(socket)
+				if err != nil {
+					// The helper process failed before listening and reports the error itself
+					return
+				}
+				listenerFile := os.NewFile(uintptr(fd), "proxy-listener")
+				defer listenerFile.Close()
+				listener, err := net.FileListener(listenerFile)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "cage: start proxy: %v\n", err)
+					return
+				}
+				proxy.Serve(listener)
+			}()
+			return nil
+		})
+
+		// The network namespace only leaves the proxy reachable,
+		// but TCP restrictions requested in addition must not deny it
+		if config.RestrictNetwork() {
+			config.AllowConnect = append(config.AllowConnect, proxyPort)
+		}
+		cmd.Env = proxyEnv(cmd.Env, fmt.Sprintf("http://127.0.0.1:%d", proxyPort))
+	}
+
+	if !config.AllowAll && (config.NoNetwork || config.RestrictHosts()) {
+		cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET
+		// Keep the current user and group IDs inside the namespace
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+		// The helper needs CAP_NET_ADMIN in the namespace to bring up the loopback interface
+		cmd.SysProcAttr.AmbientCaps = []uintptr{unix.CAP_NET_ADMIN}
+	}
+
+	if !config.AllowAll && config.UseCgroup {
+		cg, err := createCgroup(config.CgroupLimits)
+		if err != nil {
+			if config.Strict {
+				return fmt.Errorf("failed to set up cgroup: %w", err)
+			}
+			fmt.Fprintf(os.Stderr, "warning: %v; cgroup limits not enforced\n", err)
+		} else {
+			// Start the helper directly in the new cgroup so that no process escapes it
+			cmd.SysProcAttr.UseCgroupFD = true
+			cmd.SysProcAttr.CgroupFD = int(cg.dir.Fd())
+			// Processes that left the process group of the command are killed on timeout as well
+			sv.SetKillTree(cg.kill)
+			sv.AfterExit(func(state *os.ProcessState) {
+				// Processes left behind by the command, such as daemons, are killed
+				// so that they do not outlive the limits and the cgroup can be removed
+				if err := cg.kill(); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+				}
+				if state != nil {
+					cg.report(os.Stderr)
+				}
+				if err := cg.remove(); err != nil {
+					fmt.Fprintf(os.Stderr, "warning: cgroup %s not removed: %v\n", cg.path, err)
+				}
+			})
+		}
+	}
+
+	if !config.AllowAll && config.Interactive {
+		notifier, err := newNotifier(config)
+		if err != nil {
+			return err
+		}
+		setExtraFile(cmd, notifySocketFD, notifier.helperSocket)
+		// cage takes the terminal from the command's process group while it asks
+		sv.SetProcessGroup()
+		sv.AfterStart(func() error {
+			return notifier.Start(cmd.Process.Pid)
+		})
+	}
+
+	sv.AfterStart(sendConfig)
+
+	state, err := sv.Run()
+	if err != nil && cmd.Process == nil {
+		if !config.AllowAll && (config.NoNetwork || config.RestrictHosts()) {
+			return fmt.Errorf("failed to create network namespace: %w", err)
+		}
+		return fmt.Errorf("failed to start sandbox helper: %w", err)
+	}
+	if err != nil {
+		return err
+	}
+	if sv.TimedOut() {
+		os.Exit(timeoutExitCode)
+	}
+	exitWithStatus(state)
+	return nil
+}
+
+// newHelperCommand returns a command that starts the helper process for config
+// sendConfig must be called once the command has started to pass config to the helper
+// Changes to config until then are included
+func newHelperCommand(config *SandboxConfig) (cmd *exec.Cmd, sendConfig func() error, err error) {
+	configReader, configWriter, err := os.Pipe()
+	if err != nil {
+		return nil, nil, fmt.Errorf("create pipe: %w", err)
+	}
+
+	cmd = exec.Command("/proc/self/exe")
+	cmd.Args = []string{sandboxHelperName}
+	cmd.Env = config.Environ()
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{configReader}
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+
+	// The helper already receives the filtered environment
+	config.Env = EnvConfig{}
+
+	sendConfig = func() error {
+		configReader.Close()
+		defer configWriter.Close()
+		if err := json.NewEncoder(configWriter).Encode(config); err != nil {
+			return fmt.Errorf("send sandbox configuration: %w", err)
+		}
+		return nil
+	}
+	return cmd, sendConfig, nil
+}
+
+// setExtraFile passes f to the helper process as the file descriptor fd
+func setExtraFile(cmd *exec.Cmd, fd int, f *os.File) {
+	for len(cmd.ExtraFiles) <= fd-3 {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, nil)
+	}
+	cmd.ExtraFiles[fd-3] = f
+}
+
+// runSandboxHelper runs inside the helper process
+// It sets up the network namespace and the listener of the egress proxy if requested
+// and runs the command in the sandbox
+func runSandboxHelper() error {
+	var config SandboxConfig
+	configFile := os.NewFile(sandboxConfigFD, "sandbox-config")
+	if err := json.NewDecoder(configFile).Decode(&config); err != nil {
+		return fmt.Errorf("receive sandbox configuration: %w", err)
+	}
+	configFile.Close()
+
+	if !config.AllowAll && (config.NoNetwork || config.RestrictHosts()) {
+		if err := bringUpLoopback(); err != nil {
+			return fmt.Errorf("bring up loopback interface: %w", err)
+		}
+		if config.RestrictHosts() {
+			if err := sendProxyListener(); err != nil {
+				return fmt.Errorf("start proxy: %w", err)
+			}
+		}
+
+		// Drop the capabilities granted for setting up the namespace
+		// so that they are not inherited by the command
+		if err := ll.AllThreadsPrctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+			return fmt.Errorf("drop capabilities: %w", err)
+		}
+	}
+
+	path, err := exec.LookPath(config.Command)
+	if err != nil {
+		return fmt.Errorf("command not found: %w", err)
+	}
+	if config.AllowAll {
+		argv := append([]string{config.Command}, config.Args...)
+		return syscall.Exec(path, argv, os.Environ())
+	}
+	return restrictAndExec(&config, path)
+}
+
+// sendProxyListener listens on the proxy port of the loopback interface
+// and sends the listener to cage, which serves the egress proxy on it
+func sendProxyListener() error {
+	defer unix.Close(proxySocketFD)
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", proxyPort))
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	file, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return sendFD(proxySocketFD, int(file.Fd()))
+}
+
+// bringUpLoopback sets the loopback interface of the current network namespace up
+func bringUpLoopback() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifreq, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifreq); err != nil {
+		return err
+	}
+	ifreq.SetUint16(ifreq.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifreq)
+}
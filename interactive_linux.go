@@ -0,0 +1,468 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// notifySocketFD is the file descriptor on which the helper process sends the seccomp notification file descriptor
+// It is the second entry of exec.Cmd.ExtraFiles
+const notifySocketFD = 4
+
+// ioctl requests of the seccomp notification file descriptor that are missing in x/sys
+const (
+	seccompIoctlNotifIDValid = 0x40082102 // _IOW('!', 2, __u64)
+	seccompIoctlNotifAddFD   = 0x40182103 // _IOW('!', 3, struct seccomp_notif_addfd)
+)
+
+// seccompNotif is struct seccomp_notif
+type seccompNotif struct {
+	id    uint64
+	pid   uint32
+	flags uint32
+	nr    int32
+	arch  uint32
+	ip    uint64
+	args  [6]uint64
+}
+
+// seccompNotifResp is struct seccomp_notif_resp
+type seccompNotifResp struct {
+	id    uint64
+	val   int64
+	error int32
+	flags uint32
+}
+
+// seccompNotifAddFD is struct seccomp_notif_addfd
+type seccompNotifAddFD struct {
+	id         uint64
+	flags      uint32
+	srcfd      uint32
+	newfd      uint32
+	newfdFlags uint32
+}
+
+// Answers to a permission prompt
+const (
+	answerDeny = iota
+	answerOnce
+	answerAlways
+	// answerParent allows the parent directories of created or removed entries
+	answerParent
+)
+
+// notifier asks the user whether the command may write to paths outside the allowed paths
+// It receives the file system calls of the command through seccomp user notification
+// Writes outside the allowed paths are denied by Landlock, so allowed calls are carried out by cage itself
+type notifier struct {
+	// writable are the paths the command can write to
+	writable []string
+	// approved are the paths allowed with "always" during this session
+	approved []string
+	// socket receives the notification file descriptor from the helper process
+	socket *os.File
+	// helperSocket is passed to the helper process
+	helperSocket *os.File
+	// pgrp is the process group of the command
+	pgrp      int
+	tty       *os.File
+	ttyReader *bufio.Reader
+}
+
+// newNotifier returns a notifier for the command run with config
+func newNotifier(config *SandboxConfig) (*notifier, error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("create socket pair: %w", err)
+	}
+	return &notifier{
+		writable:     append([]string{"/dev/null"}, config.AllowedPaths...),
+		socket:       os.NewFile(uintptr(fds[0]), "notify-socket"),
+		helperSocket: os.NewFile(uintptr(fds[1]), "notify-socket-helper"),
+	}, nil
+}
+
+// Start receives the notification file descriptor once the helper process has started
+// and handles notifications until the command exits
+// pgrp is the process group of the command
+func (n *notifier) Start(pgrp int) error {
+	n.pgrp = pgrp
+	n.helperSocket.Close()
+	go func() {
+		defer n.socket.Close()
+		fd, err := receiveFD(n.socket)
+		if err != nil {
+			// The helper process failed before installing the filter and reports the error itself
+			return
+		}
+		defer unix.Close(fd)
+		if err := n.serve(fd); err != nil {
+			fmt.Fprintf(os.Stderr, "cage: interactive mode stopped: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// serve handles notifications until no process uses the filter anymore
+func (n *notifier) serve(fd int) error {
+	for {
+		var req seccompNotif
+		if err := ioctl(fd, unix.SECCOMP_IOCTL_NOTIF_RECV, unsafe.Pointer(&req)); err != nil {
+			switch {
+			case errors.Is(err, unix.EINTR), errors.Is(err, unix.ENOENT):
+				// The calling process was interrupted or killed before the notification was received
+				continue
+			case errors.Is(err, unix.EBADF), errors.Is(err, unix.ENOTTY):
+				return nil
+			}
+			return fmt.Errorf("receive notification: %w", err)
+		}
+		n.handle(fd, &req)
+	}
+}
+
+// handle responds to a notification
+func (n *notifier) handle(fd int, req *seccompNotif) {
+	access, ok := readFileAccess(int(req.pid), uint64(req.nr), req.args)
+	// The process may have exited and its ID reused while its memory was read
+	if ioctl(fd, seccompIoctlNotifIDValid, unsafe.Pointer(&req.id)) != nil {
+		return
+	}
+	// Landlock decides about writes that are not outside the allowed paths
+	if !ok || !n.needsApproval(access) {
+		respond(fd, req.id, 0, 0, unix.SECCOMP_USER_NOTIF_FLAG_CONTINUE)
+		return
+	}
+
+	// The user is asked about the entries, and only about their directories if they choose so
+	// Entries that were allowed before are written by cage even if Landlock denies creating them
+	// Only entries that Landlock can allow in later runs are saved, otherwise only their directories can be
+	var unapproved, parents []string
+	var saved []AllowPath
+	savable := true
+	for i, path := range access.writes {
+		entry := access.entries[i]
+		if containsPath(n.writable, path) || containsPath(n.writable, entry) || containsPath(n.approved, entry) {
+			continue
+		}
+		unapproved = append(unapproved, entry)
+		if path != entry && !slices.Contains(parents, path) {
+			parents = append(parents, path)
+		}
+		allow, ok := savedEntry(access, i)
+		saved = append(saved, allow)
+		savable = savable && ok
+	}
+	if len(unapproved) > 0 {
+		switch n.ask(int(req.pid), access, unapproved, parents, savable) {
+		case answerDeny:
+			respond(fd, req.id, 0, unix.EACCES, 0)
+			return
+		case answerAlways:
+			n.approved = append(n.approved, unapproved...)
+			n.save(saved)
+		case answerParent:
+			n.approved = append(n.approved, parents...)
+			var dirs []AllowPath
+			for _, parent := range parents {
+				dirs = append(dirs, AllowPath{Path: parent})
+			}
+			n.save(dirs)
+		}
+	}
+
+	newfd, val, err := emulate(int(req.pid), access)
+	var errno unix.Errno
+	if err != nil && !errors.As(err, &errno) {
+		errno = unix.EIO
+	}
+	if newfd < 0 {
+		respond(fd, req.id, val, errno, 0)
+		return
+	}
+	defer unix.Close(newfd)
+	addfd := seccompNotifAddFD{
+		id:         req.id,
+		flags:      unix.SECCOMP_ADDFD_FLAG_SEND,
+		srcfd:      uint32(newfd),
+		newfdFlags: uint32(access.how.Flags & unix.O_CLOEXEC),
+	}
+	if err := ioctl(fd, seccompIoctlNotifAddFD, unsafe.Pointer(&addfd)); err != nil {
+		if !errors.Is(err, unix.EINVAL) {
+			respond(fd, req.id, 0, unix.EIO, 0)
+			return
+		}
+		// SECCOMP_ADDFD_FLAG_SEND requires Linux 5.14, before that the file descriptor is returned by the response
+		addfd.flags = 0
+		target, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), seccompIoctlNotifAddFD, uintptr(unsafe.Pointer(&addfd)))
+		if errno != 0 {
+			respond(fd, req.id, 0, unix.EIO, 0)
+			return
+		}
+		respond(fd, req.id, int64(target), 0, 0)
+	}
+}
+
+// needsApproval reports whether a file system call writes outside the allowed paths
+func (n *notifier) needsApproval(access *fileAccess) bool {
+	for _, path := range access.writes {
+		if !containsPath(n.writable, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// savedEntry returns the allow entry that lets later runs write the i-th entry of a file system call
+// It reports false if Landlock cannot allow the call without allowing the whole directory,
+// like removing or renaming an entry, or creating one that must not exist yet
+func savedEntry(access *fileAccess, i int) (AllowPath, bool) {
+	entry := access.entries[i]
+	switch {
+	case access.writes[i] == entry:
+		return AllowPath{Path: entry}, true
+	case access.creates != "" && access.how.Flags&unix.O_EXCL == 0:
+		// The entry is created before later runs, so that Landlock can grant access to it
+		return AllowPath{Path: entry, Create: access.creates}, true
+	}
+	return AllowPath{Path: entry}, false
+}
+
+// ask asks the user on the terminal whether a file system call may write to paths
+// If parents is not empty, the user can also allow these directories of the paths
+// If savable is false, the paths can only be allowed once, because they cannot be allowed in later runs
+func (n *notifier) ask(pid int, access *fileAccess, paths, parents []string, savable bool) int {
+	if n.tty == nil {
+		tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cage: cannot ask for permission to write to %s: %v\n", strings.Join(paths, ", "), err)
+			return answerDeny
+		}
+		n.tty = tty
+		n.ttyReader = bufio.NewReader(tty)
+	}
+
+	// Reading from the terminal in the background would stop cage with SIGTTIN,
+	// so cage takes the terminal from the command while it asks
+	// The command is stopped if it reads from the terminal in the meantime, and continued afterwards
+	fd := int(n.tty.Fd())
+	foreground, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cage: cannot ask for permission to write to %s: %v\n", strings.Join(paths, ", "), err)
+		return answerDeny
+	}
+	if foreground != syscall.Getpgrp() {
+		if pgrp, err := unix.Getpgid(pid); foreground != n.pgrp && (err != nil || foreground != pgrp) {
+			fmt.Fprintf(os.Stderr, "cage: cannot ask for permission to write to %s: cage is in the background\n", strings.Join(paths, ", "))
+			return answerDeny
+		}
+		// Changing the foreground process group from the background raises SIGTTOU
+		signal.Ignore(syscall.SIGTTOU)
+		defer signal.Reset(syscall.SIGTTOU)
+		if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, syscall.Getpgrp()); err != nil {
+			fmt.Fprintf(os.Stderr, "cage: cannot ask for permission to write to %s: %v\n", strings.Join(paths, ", "), err)
+			return answerDeny
+		}
+		defer func() {
+			_ = unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, foreground)
+			_ = syscall.Kill(-foreground, syscall.SIGCONT)
+		}()
+	}
+
+	comm, _ := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	fmt.Fprintf(
+		n.tty,
+		"cage: %s (pid %d): %s %s needs write access to %s\n",
+		strings.TrimSpace(string(comm)),
+		pid,
+		access.name,
+		strings.Join(access.paths, " "),
+		strings.Join(paths, ", "),
+	)
+	options := []string{"[o]nce"}
+	if savable {
+		options = append(options, "[a]lways for this project")
+	}
+	if len(parents) > 0 {
+		options = append(options, "always for all of [p]arent "+strings.Join(parents, ", "))
+	}
+	fmt.Fprintf(n.tty, "cage: allow %s, or [d]eny? ", strings.Join(options, ", "))
+	line, err := n.ttyReader.ReadString('\n')
+	if err != nil {
+		fmt.Fprintln(n.tty)
+		return answerDeny
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "o", "once", "y", "yes":
+		return answerOnce
+	case "a", "always":
+		if savable {
+			return answerAlways
+		}
+	case "p", "parent":
+		if len(parents) > 0 {
+			return answerParent
+		}
+	}
+	return answerDeny
+}
+
+// save adds allow entries to the project configuration
+func (n *notifier) save(entries []AllowPath) {
+	path, err := projectConfigPath()
+	if err == nil {
+		err = addProjectAllowPaths(path, entries)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: allowed paths not saved: %v\n", err)
+		return
+	}
+	var paths []string
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	fmt.Fprintf(os.Stderr, "cage: added %s to the %s preset in %s\n", strings.Join(paths, ", "), interactivePresetName, path)
+}
+
+// emulate carries out a file system call for the process pid
+// It returns a file descriptor to install in the process for open system calls, or -1 and the return value
+func emulate(pid int, access *fileAccess) (newfd int, val int64, err error) {
+	args := access.args
+	// next is the index of the first argument after the path arguments
+	next := access.fileSyscall.paths[len(access.fileSyscall.paths)-1].path + 1
+
+	// Symbolic links in the paths were resolved before the user was asked, so the parent directories
+	// are opened without following any, and only the last components are resolved relative to them
+	// A process cannot redirect the call to another file by replacing a path component in the meantime
+	dirfds := make([]int, len(access.paths))
+	names := make([]string, len(access.paths))
+	for i, path := range access.paths {
+		dirfd, err := unix.Openat2(unix.AT_FDCWD, filepath.Dir(path), &unix.OpenHow{
+			Flags:   unix.O_PATH | unix.O_DIRECTORY | unix.O_CLOEXEC,
+			Resolve: unix.RESOLVE_NO_SYMLINKS,
+		})
+		if err != nil {
+			return -1, 0, err
+		}
+		defer unix.Close(dirfd)
+		dirfds[i], names[i] = dirfd, filepath.Base(path)
+	}
+	// openEntry opens the last component of the first path
+	openEntry := func(how *unix.OpenHow) (int, error) {
+		how.Flags |= unix.O_CLOEXEC
+		how.Resolve = unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS
+		return unix.Openat2(dirfds[0], names[0], how)
+	}
+
+	switch access.name {
+	case "open", "openat", "openat2", "creat":
+		how := access.how
+		if access.name == "creat" {
+			how = unix.OpenHow{Flags: unix.O_CREAT | unix.O_WRONLY | unix.O_TRUNC, Mode: args[1]}
+		}
+		// openat2 rejects a mode that is not used or has other bits than the permissions
+		if how.Flags&unix.O_CREAT == 0 && how.Flags&unix.O_TMPFILE != unix.O_TMPFILE {
+			how.Mode = 0
+		}
+		how.Mode &= 0o7777
+		fd, err := openEntry(&how)
+		if err != nil {
+			return -1, 0, err
+		}
+		return fd, 0, nil
+	case "truncate":
+		// A FIFO would block until it is opened for reading
+		var fd int
+		fd, err = openEntry(&unix.OpenHow{Flags: unix.O_WRONLY | unix.O_NONBLOCK})
+		if err == nil {
+			err = unix.Ftruncate(fd, int64(args[next]))
+			unix.Close(fd)
+		}
+	case "mkdir", "mkdirat":
+		err = unix.Mkdirat(dirfds[0], names[0], uint32(args[next]))
+	case "mknod", "mknodat":
+		err = unix.Mknodat(dirfds[0], names[0], uint32(args[next]), int(args[next+1]))
+	case "rmdir":
+		err = unix.Unlinkat(dirfds[0], names[0], unix.AT_REMOVEDIR)
+	case "unlink":
+		err = unix.Unlinkat(dirfds[0], names[0], 0)
+	case "unlinkat":
+		err = unix.Unlinkat(dirfds[0], names[0], int(args[next]))
+	case "rename", "renameat":
+		err = unix.Renameat2(dirfds[0], names[0], dirfds[1], names[1], 0)
+	case "renameat2":
+		err = unix.Renameat2(dirfds[0], names[0], dirfds[1], names[1], uint(args[next]))
+	case "link":
+		err = unix.Linkat(dirfds[0], names[0], dirfds[1], names[1], 0)
+	case "linkat":
+		err = unix.Linkat(dirfds[0], names[0], dirfds[1], names[1], int(args[next]))
+	case "symlink", "symlinkat":
+		var target string
+		target, err = readString(pid, uintptr(args[0]))
+		if err == nil {
+			err = unix.Symlinkat(target, dirfds[0], names[0])
+		}
+	default:
+		err = unix.ENOSYS
+	}
+	return -1, 0, err
+}
+
+// respond sends the response to a notification
+// Responses to processes that were killed in the meantime fail, which is ignored
+func respond(fd int, id uint64, val int64, errno unix.Errno, flags uint32) {
+	resp := seccompNotifResp{id: id, val: val, error: -int32(errno), flags: flags}
+	_ = ioctl(fd, unix.SECCOMP_IOCTL_NOTIF_SEND, unsafe.Pointer(&resp))
+}
+
+// ioctl calls ioctl with a pointer argument
+func ioctl(fd int, req uint, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(req), uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// sendFD sends a file descriptor over a Unix socket
+func sendFD(socket int, fd int) error {
+	return unix.Sendmsg(socket, []byte{0}, unix.UnixRights(fd), nil, 0)
+}
+
+// receiveFD receives a file descriptor sent by sendFD
+func receiveFD(socket *os.File) (int, error) {
+	buf := make([]byte, 1)
+	oob := make([]byte, unix.CmsgSpace(4))
+	_, oobn, _, _, err := unix.Recvmsg(int(socket.Fd()), buf, oob, unix.MSG_CMSG_CLOEXEC)
+	if err != nil {
+		return -1, err
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return -1, err
+	}
+	if len(msgs) == 0 {
+		return -1, syscall.EBADMSG
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil {
+		return -1, err
+	}
+	if len(fds) != 1 {
+		return -1, syscall.EBADMSG
+	}
+	return fds[0], nil
+}
@@ -0,0 +1,170 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestInteractiveAnswerAppliesToLaterRuns(t *testing.T) {
+	tmpDir := t.TempDir()
+	home := filepath.Join(tmpDir, "home")
+	project := filepath.Join(tmpDir, "project")
+	for _, dir := range []string{home, project} {
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(tmpDir, "config"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(tmpDir, "state"))
+	t.Setenv(cageConfigEnv, "")
+	t.Setenv("GIT_CEILING_DIRECTORIES", tmpDir)
+	t.Chdir(project)
+
+	// The first run creates ~/.npmrc, which is answered with "always"
+	npmrc := filepath.Join(home, ".npmrc")
+	created := &fileAccess{
+		fileSyscall: fileSyscalls[unix.SYS_OPENAT],
+		how:         unix.OpenHow{Flags: unix.O_WRONLY | unix.O_CREAT},
+		paths:       []string{npmrc},
+		writes:      []string{home},
+		entries:     []string{npmrc},
+	}
+	first := &notifier{writable: []string{"/dev/null", project}}
+	if !first.needsApproval(created) {
+		t.Fatal("first run: needsApproval() = false, want true")
+	}
+	entry, ok := savedEntry(created, 0)
+	if !ok {
+		t.Fatal("savedEntry() cannot save the created file")
+	}
+	first.save([]AllowPath{entry})
+
+	// The second run applies the saved answer without -preset, and ~/.npmrc no longer exists
+	config, err := loadConfigFiles(configFiles(nil))
+	if err != nil {
+		t.Fatalf("loadConfigFiles() error = %v", err)
+	}
+	presets, err := config.ResolveCommandPresets(nil, "npm", "install")
+	if err != nil {
+		t.Fatalf("ResolveCommandPresets() error = %v", err)
+	}
+	if !slices.Equal(presets, []string{interactivePresetName}) {
+		t.Fatalf("ResolveCommandPresets() = %v, want [%s]", presets, interactivePresetName)
+	}
+	sandboxConfig := &SandboxConfig{
+		AllowedPaths: []string{project},
+		CreatePaths:  make(map[string]string),
+	}
+	for _, name := range presets {
+		preset, _ := config.GetPreset(name)
+		processed, err := preset.ProcessPreset()
+		if err != nil {
+			t.Fatalf("ProcessPreset() error = %v", err)
+		}
+		for _, path := range processed.Allow {
+			sandboxConfig.AllowedPaths = append(sandboxConfig.AllowedPaths, path.Path)
+			if path.Create != "" {
+				sandboxConfig.CreatePaths[path.Path] = path.Create
+			}
+		}
+	}
+	modifySandboxConfig(sandboxConfig)
+	createAllowedPaths(sandboxConfig)
+
+	// The file exists again, so Landlock grants access to it and opening it is not asked about
+	if _, err := os.Stat(npmrc); err != nil {
+		t.Fatalf("%s was not created: %v", npmrc, err)
+	}
+	if !slices.Contains(sandboxConfig.AllowedPaths, npmrc) {
+		t.Errorf("AllowedPaths = %v, want %s", sandboxConfig.AllowedPaths, npmrc)
+	}
+	written := &fileAccess{
+		fileSyscall: fileSyscalls[unix.SYS_OPENAT],
+		how:         unix.OpenHow{Flags: unix.O_WRONLY | unix.O_CREAT},
+		paths:       []string{npmrc},
+		writes:      []string{npmrc},
+		entries:     []string{npmrc},
+	}
+	second := &notifier{writable: append([]string{"/dev/null"}, sandboxConfig.AllowedPaths...)}
+	if second.needsApproval(written) {
+		t.Error("second run: needsApproval() = true, want false")
+	}
+}
+
+func TestSavedEntry(t *testing.T) {
+	dir := "/home/user"
+	file := filepath.Join(dir, "file")
+	tests := []struct {
+		name   string
+		nr     uint64
+		flags  uint64
+		write  string
+		want   AllowPath
+		wantOK bool
+	}{
+		{
+			name:   "existing file",
+			nr:     unix.SYS_OPENAT,
+			flags:  unix.O_WRONLY,
+			write:  file,
+			want:   AllowPath{Path: file},
+			wantOK: true,
+		},
+		{
+			name:   "created file",
+			nr:     unix.SYS_OPENAT,
+			flags:  unix.O_WRONLY | unix.O_CREAT,
+			write:  dir,
+			want:   AllowPath{Path: file, Create: AllowCreateFile},
+			wantOK: true,
+		},
+		{
+			name:  "file that must not exist",
+			nr:    unix.SYS_OPENAT,
+			flags: unix.O_WRONLY | unix.O_CREAT | unix.O_EXCL,
+			write: dir,
+			want:  AllowPath{Path: file},
+		},
+		{
+			name:   "created directory",
+			nr:     unix.SYS_MKDIRAT,
+			write:  dir,
+			want:   AllowPath{Path: file, Create: AllowCreateDirectory},
+			wantOK: true,
+		},
+		{
+			name:  "removed file",
+			nr:    unix.SYS_UNLINKAT,
+			write: dir,
+			want:  AllowPath{Path: file},
+		},
+		{
+			name:  "renamed file",
+			nr:    unix.SYS_RENAMEAT2,
+			write: dir,
+			want:  AllowPath{Path: file},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access := &fileAccess{
+				fileSyscall: fileSyscalls[tt.nr],
+				how:         unix.OpenHow{Flags: tt.flags},
+				writes:      []string{tt.write},
+				entries:     []string{file},
+			}
+			got, ok := savedEntry(access, 0)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("savedEntry() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	ll "github.com/landlock-lsm/go-landlock/landlock/syscall"
+)
+
+// landlockFeature is a restriction enforced with Landlock
+// and the ABI version that introduced it
+type landlockFeature struct {
+	name string
+	abi  int
+}
+
+// landlockABIVersion returns the Landlock ABI version supported by the kernel
+// It returns 0 if Landlock is not available
+func landlockABIVersion() int {
+	abi, err := ll.LandlockGetABIVersion()
+	if err != nil {
+		return 0
+	}
+	return abi
+}
+
+// requiredLandlockFeatures returns the Landlock features needed to enforce the configuration
+func requiredLandlockFeatures(config *SandboxConfig) []landlockFeature {
+	features := []landlockFeature{
+		{name: "filesystem access restrictions", abi: 1},
+	}
+	if len(config.AllowedPaths) > 0 {
+		features = append(features, landlockFeature{
+			name: "renaming and linking files between allowed directories",
+			abi:  2,
+		})
+	}
+	features = append(features, landlockFeature{name: "file truncation restrictions", abi: 3})
+	// Allowed hosts rely on the network namespace, where only the proxy is reachable
+	if config.RestrictNetwork() {
+		features = append(features, landlockFeature{name: "TCP connect and bind restrictions", abi: 4})
+	}
+	features = append(features, landlockFeature{name: "ioctl restrictions on device files", abi: 5})
+	if config.ScopeSignals {
+		features = append(features, landlockFeature{name: "signal scoping", abi: 6})
+	}
+	if config.ScopeAbstractSockets {
+		features = append(features, landlockFeature{name: "abstract Unix socket scoping", abi: 6})
+	}
+	return features
+}
+
+// unsupportedLandlockFeatures returns the required features that the given ABI version cannot enforce
+func unsupportedLandlockFeatures(config *SandboxConfig, abi int) []landlockFeature {
+	var unsupported []landlockFeature
+	for _, feature := range requiredLandlockFeatures(config) {
+		if feature.abi > abi {
+			unsupported = append(unsupported, feature)
+		}
+	}
+	return unsupported
+}
+
+// checkLandlockABI verifies that the kernel can enforce the configuration
+// It returns an error if the ABI requirements of the configuration are not met,
+// and otherwise warns about each feature that will not be enforced
+func checkLandlockABI(config *SandboxConfig) (int, error) {
+	abi := landlockABIVersion()
+
+	if abi < config.MinABI {
+		return abi, fmt.Errorf(
+			"kernel supports Landlock ABI %d, but ABI %d is required",
+			abi,
+			config.MinABI,
+		)
+	}
+
+	unsupported := unsupportedLandlockFeatures(config, abi)
+	if len(unsupported) == 0 {
+		return abi, nil
+	}
+
+	if config.Strict {
+		names := make([]string, 0, len(unsupported))
+		for _, feature := range unsupported {
+			names = append(names, fmt.Sprintf("%s (ABI %d)", feature.name, feature.abi))
+		}
+		return abi, fmt.Errorf(
+			"kernel supports Landlock ABI %d, which cannot enforce: %s",
+			abi,
+			strings.Join(names, ", "),
+		)
+	}
+
+	if abi == 0 {
+		fmt.Fprintf(
+			os.Stderr,
+			"warning: Landlock is not available on this kernel; the command runs without a sandbox\n",
+		)
+		return abi, nil
+	}
+	for _, feature := range unsupported {
+		fmt.Fprintf(
+			os.Stderr,
+			"warning: %s not enforced: requires Landlock ABI %d, kernel supports ABI %d\n",
+			feature.name,
+			feature.abi,
+			abi,
+		)
+	}
+	return abi, nil
+}
@@ -0,0 +1,72 @@
+//go:build linux
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnsupportedLandlockFeatures(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *SandboxConfig
+		abi    int
+		want   []int
+	}{
+		{
+			name:   "latest ABI supports everything",
+			config: &SandboxConfig{AllowedPaths: []string{"/tmp"}, AllowConnect: []uint16{443}},
+			abi:    5,
+			want:   nil,
+		},
+		{
+			name:   "no Landlock support",
+			config: &SandboxConfig{},
+			abi:    0,
+			want:   []int{1, 3, 5},
+		},
+		{
+			name:   "network rules on ABI 3",
+			config: &SandboxConfig{AllowedPaths: []string{"/tmp"}, AllowConnect: []uint16{443}},
+			abi:    3,
+			want:   []int{4, 5},
+		},
+		{
+			name:   "allowed hosts do not need network rules",
+			config: &SandboxConfig{AllowHosts: []string{"example.com"}},
+			abi:    3,
+			want:   []int{5},
+		},
+		{
+			name:   "refer is only required with allowed paths",
+			config: &SandboxConfig{},
+			abi:    1,
+			want:   []int{3, 5},
+		},
+		{
+			name:   "scopes on ABI 5",
+			config: &SandboxConfig{ScopeSignals: true, ScopeAbstractSockets: true},
+			abi:    5,
+			want:   []int{6, 6},
+		},
+		{
+			name:   "scopes on ABI 6",
+			config: &SandboxConfig{ScopeSignals: true, ScopeAbstractSockets: true},
+			abi:    6,
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, feature := range unsupportedLandlockFeatures(tt.config, tt.abi) {
+				got = append(got, feature.abi)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unsupportedLandlockFeatures() ABIs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// learnOptions configures the learn subcommand
+type learnOptions struct {
+	// permissive runs the command without restrictions and records every path written
+	permissive bool
+	// name is the name of the generated preset
+	name string
+	// output is the file to write the generated preset to instead of stdout
+	output string
+}
+
+// registerLearnFlags registers the flags of the learn subcommand
+// in addition to the regular flags, which define the policy the command is run with
+func registerLearnFlags() *learnOptions {
+	opts := &learnOptions{}
+
+	flag.BoolVar(
+		&opts.permissive,
+		"permissive",
+		false,
+		"Run the command without restrictions and record every path written (learn only)",
+	)
+
+	flag.StringVar(
+		&opts.name,
+		"name",
+		"",
+		"Name of the generated preset, defaults to the command name (learn only)",
+	)
+
+	flag.StringVar(
+		&opts.output,
+		"output",
+		"",
+		"Write the generated preset to a file instead of stdout (learn only)",
+	)
+
+	return opts
+}
+
+// learnedWrite is a recorded write
+type learnedWrite struct {
+	// path is the path that needs write access
+	path string
+	// entry is the entry created or removed in the directory path, or empty if path itself was written
+	// Landlock checks these calls on the directory, so the preset allows the whole directory
+	entry string
+}
+
+// writeLearnedPreset writes a preset allowing writes to the recorded paths
+func writeLearnedPreset(config *SandboxConfig, opts *learnOptions, written []learnedWrite) error {
+	name := opts.name
+	if name == "" {
+		name = filepath.Base(config.Command)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("get working directory: %w", err)
+	}
+	home, _ := os.UserHomeDir()
+
+	// Paths that are already writable do not need to be in the preset
+	writable := append([]string{"/dev/null"}, config.AllowedPaths...)
+	var writtenPaths []string
+	entries := map[string][]string{}
+	for _, write := range written {
+		writtenPaths = append(writtenPaths, write.path)
+		if write.entry != "" && !slices.Contains(entries[write.path], write.entry) {
+			entries[write.path] = append(entries[write.path], write.entry)
+		}
+	}
+	var paths []string
+	for _, path := range minimizeWritePaths(writtenPaths) {
+		if !containsPath(writable, path) {
+			paths = append(paths, path)
+		}
+	}
+	preset := learnedPresetYAML(name, paths, entries, cwd, home)
+
+	var w io.Writer = os.Stdout
+	if opts.output != "" {
+		f, err := os.Create(opts.output)
+		if err != nil {
+			return fmt.Errorf("create output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := io.WriteString(w, preset); err != nil {
+		return fmt.Errorf("write preset: %w", err)
+	}
+	return nil
+}
+
+// minimizeWritePaths sorts and deduplicates paths and removes paths under another path
+func minimizeWritePaths(paths []string) []string {
+	paths = slices.Clone(paths)
+	for i, path := range paths {
+		paths[i] = filepath.Clean(path)
+	}
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+
+	var result []string
+	for _, path := range paths {
+		// Sorting puts a directory before the paths under it
+		if !containsPath(result, path) {
+			result = append(result, path)
+		}
+	}
+	return result
+}
+
+// learnedPresetYAML formats a config file with a single preset allowing writes to paths
+// Paths under the working directory are made relative to it,
+// and other paths under the home directory are made relative to $HOME
+// Directories that are only allowed because entries were created or removed in them
+// are preceded by a comment listing these entries
+func learnedPresetYAML(name string, paths []string, entries map[string][]string, cwd, home string) string {
+	var b strings.Builder
+	b.WriteString("presets:\n")
+	fmt.Fprintf(&b, "  %s:\n", name)
+	if len(paths) == 0 {
+		b.WriteString("    allow: []\n")
+		return b.String()
+	}
+	b.WriteString("    allow:\n")
+	for _, path := range paths {
+		if len(entries[path]) > 0 {
+			created := make([]string, len(entries[path]))
+			for i, entry := range entries[path] {
+				created[i] = presetPath(entry, cwd, home)
+			}
+			fmt.Fprintf(&b, "      # the directory, to create or remove %s\n", strings.Join(created, ", "))
+		}
+		fmt.Fprintf(&b, "      - %q\n", presetPath(path, cwd, home))
+	}
+	return b.String()
+}
+
+// presetPath converts an absolute path to the form used in presets
+func presetPath(path, cwd, home string) string {
+	if rel, ok := relativePath(path, cwd); ok {
+		return rel
+	}
+	if rel, ok := relativePath(path, home); ok {
+		if rel == "." {
+			return "$HOME"
+		}
+		return "$HOME/" + rel
+	}
+	return path
+}
+
+// relativePath returns path relative to base if it is base or under it
+func relativePath(path, base string) (string, bool) {
+	if base == "" || base == "/" || !isUnder(path, base) {
+		return "", false
+	}
+	rel, err := filepath.Rel(base, path)
+	if err != nil {
+		return "", false
+	}
+	return rel, true
+}
+
+// isUnder reports whether path is dir or a path under dir
+func isUnder(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// containsPath reports whether path is one of dirs or under one of them
+func containsPath(dirs []string, path string) bool {
+	return slices.ContainsFunc(dirs, func(dir string) bool {
+		return isUnder(path, dir)
+	})
+}
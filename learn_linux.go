@@ -0,0 +1,220 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// tracee is a process traced in learn mode
+type tracee struct {
+	// inSyscall is set between the system call entry and exit stops
+	inSyscall bool
+	// nr is the system call being executed
+	nr uint64
+	// writes are the writes of the current system call
+	writes []learnedWrite
+}
+
+// runLearn runs the command under ptrace and writes a preset allowing the writes it attempted
+// Without permissive mode, only writes denied by the sandbox are recorded
+func runLearn(config *SandboxConfig, opts *learnOptions) error {
+	modifySandboxConfig(config)
+	if err := exportPolicy(config); err != nil {
+		return err
+	}
+	if config.NoNetwork || config.RestrictHosts() || config.UseCgroup || config.Timeout > 0 || config.Interactive {
+		fmt.Fprintf(os.Stderr, "warning: -no-network, -allow-host, -cgroup, -timeout and -interactive are not applied in learn mode\n")
+		config.NoNetwork = false
+		config.AllowHosts = nil
+		config.UseCgroup = false
+		config.Timeout = 0
+		config.Interactive = false
+	}
+	if opts.permissive {
+		config.AllowAll = true
+	}
+	if _, err := exec.LookPath(config.Command); err != nil {
+		return fmt.Errorf("command not found: %w", err)
+	}
+
+	cmd, sendConfig, err := newHelperCommand(config)
+	if err != nil {
+		return err
+	}
+	cmd.SysProcAttr.Ptrace = true
+
+	// All ptrace requests must come from the thread that started the command
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start command: %w", err)
+	}
+	if err := sendConfig(); err != nil {
+		_ = cmd.Process.Kill()
+		return err
+	}
+
+	// Signals reach the command through the terminal or are forwarded by the tracing loop
+	signal.Ignore(syscall.SIGINT, syscall.SIGQUIT)
+
+	written, status, err := trace(cmd.Process.Pid, opts.permissive)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		return err
+	}
+
+	if len(written) == 0 {
+		fmt.Fprintf(os.Stderr, "cage: no writes were recorded\n")
+	}
+	if err := writeLearnedPreset(config, opts, written); err != nil {
+		return err
+	}
+	exitWithWaitStatus(status)
+	return nil
+}
+
+// trace follows the started process and its descendants until the process exits
+// It returns the recorded writes in the order they were first made, and the wait status of the process
+func trace(pid int, permissive bool) ([]learnedWrite, syscall.WaitStatus, error) {
+	tracees := map[int]*tracee{}
+	seen := map[learnedWrite]struct{}{}
+	var written []learnedWrite
+
+	for {
+		var ws unix.WaitStatus
+		wpid, err := unix.Wait4(-1, &ws, unix.WALL, nil)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("wait for command: %w", err)
+		}
+
+		if ws.Exited() || ws.Signaled() {
+			delete(tracees, wpid)
+			if wpid == pid {
+				// Remaining processes are killed when cage exits because of PTRACE_O_EXITKILL
+				return written, syscall.WaitStatus(ws), nil
+			}
+			continue
+		}
+		if !ws.Stopped() {
+			continue
+		}
+
+		t, ok := tracees[wpid]
+		if !ok {
+			t = &tracee{}
+			tracees[wpid] = t
+			if wpid == pid {
+				// The command stops after the helper is executed
+				err := unix.PtraceSetOptions(pid, unix.PTRACE_O_TRACESYSGOOD|
+					unix.PTRACE_O_TRACEFORK|
+					unix.PTRACE_O_TRACEVFORK|
+					unix.PTRACE_O_TRACECLONE|
+					unix.PTRACE_O_TRACEEXEC|
+					unix.PTRACE_O_EXITKILL)
+				if err != nil {
+					return nil, 0, fmt.Errorf("set ptrace options: %w", err)
+				}
+			}
+			// New processes start with SIGSTOP, which is not delivered
+			_ = unix.PtraceSyscall(wpid, 0)
+			continue
+		}
+
+		inject := 0
+		switch sig := ws.StopSignal(); {
+		case sig == syscall.SIGTRAP|0x80:
+			if !t.inSyscall {
+				t.nr, t.writes = syscallEntry(wpid)
+			} else if len(t.writes) > 0 {
+				if ret, err := syscallReturn(wpid); err == nil && recordWrite(ret, permissive) {
+					for _, write := range t.writes {
+						if _, ok := seen[write]; !ok {
+							seen[write] = struct{}{}
+							written = append(written, write)
+							describeWrite(fileSyscalls[t.nr].name, write, permissive)
+						}
+					}
+				}
+				t.writes = nil
+			}
+			t.inSyscall = !t.inSyscall
+		case sig == syscall.SIGTRAP:
+			// Events for fork, clone and exec
+			// If another thread called execve, it takes over the process ID,
+			// so the state of the stopped thread is replaced by the one of execve
+			if ws.TrapCause() == unix.PTRACE_EVENT_EXEC {
+				t.inSyscall = true
+				t.writes = nil
+			}
+		case isGroupStop(wpid):
+			// The process was stopped by a stop signal and must not receive it again
+		default:
+			inject = int(sig)
+		}
+		_ = unix.PtraceSyscall(wpid, inject)
+	}
+}
+
+// recordWrite reports whether a system call with the return value ret is recorded
+func recordWrite(ret int64, permissive bool) bool {
+	if permissive {
+		return ret >= 0
+	}
+	return ret == -int64(unix.EACCES) || ret == -int64(unix.EPERM)
+}
+
+// describeWrite prints a recorded write
+func describeWrite(name string, write learnedWrite, permissive bool) {
+	path := write.path
+	if write.entry != "" {
+		path = write.entry
+	}
+	if permissive {
+		fmt.Fprintf(os.Stderr, "cage: write: %s %s\n", name, path)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "cage: write denied: %s %s\n", name, path)
+}
+
+// syscallEntry returns the system call a tracee is entering and its writes
+// The paths are resolved at entry because the working directory and file descriptors may change
+func syscallEntry(pid int) (uint64, []learnedWrite) {
+	nr, args, err := syscallRegs(pid)
+	if err != nil {
+		return 0, nil
+	}
+	access, ok := readFileAccess(pid, nr, args)
+	if !ok {
+		return nr, nil
+	}
+	writes := make([]learnedWrite, len(access.writes))
+	for i, path := range access.writes {
+		writes[i] = learnedWrite{path: path}
+		if entry := access.entries[i]; entry != path {
+			writes[i].entry = entry
+		}
+	}
+	return nr, writes
+}
+
+// isGroupStop reports whether a stopped tracee is in a group-stop rather than a signal-delivery-stop
+// PTRACE_GETSIGINFO fails for group-stops
+func isGroupStop(pid int) bool {
+	var info [128]byte
+	_, _, errno := unix.Syscall6(unix.SYS_PTRACE, unix.PTRACE_GETSIGINFO, uintptr(pid), 0, uintptr(unsafe.Pointer(&info[0])), 0, 0)
+	return errno == unix.EINVAL
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// runLearn is not supported because it relies on ptrace
+func runLearn(config *SandboxConfig, opts *learnOptions) error {
+	return fmt.Errorf("learn mode is only supported on Linux")
+}
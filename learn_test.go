@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMinimizeWritePaths(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{
+			name:  "empty",
+			paths: nil,
+			want:  nil,
+		},
+		{
+			name:  "duplicates are removed",
+			paths: []string{"/tmp/b", "/tmp/a", "/tmp/b/"},
+			want:  []string{"/tmp/a", "/tmp/b"},
+		},
+		{
+			name:  "paths under another path are removed",
+			paths: []string{"/home/user/.cache/go/x", "/home/user/.cache", "/home/user/.cache-other"},
+			want:  []string{"/home/user/.cache", "/home/user/.cache-other"},
+		},
+		{
+			name:  "sibling sorted between directory and child",
+			paths: []string{"/a/b/c", "/a/b-c", "/a/b"},
+			want:  []string{"/a/b", "/a/b-c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := minimizeWritePaths(tt.paths)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("minimizeWritePaths(%v) = %v, want %v", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresetPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/home/user/project", want: "."},
+		{path: "/home/user/project/build", want: "build"},
+		{path: "/home/user/.cache/go-build", want: "$HOME/.cache/go-build"},
+		{path: "/home/user", want: "$HOME"},
+		{path: "/home/username", want: "/home/username"},
+		{path: "/tmp", want: "/tmp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := presetPath(tt.path, "/home/user/project", "/home/user")
+			if got != tt.want {
+				t.Errorf("presetPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLearnedPresetYAML(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{filepath.Join(cwd, "build"), filepath.Join(home, ".cache"), "/tmp"}
+	// The cache directory is allowed because files were created in it
+	entries := map[string][]string{
+		filepath.Join(home, ".cache"): {filepath.Join(home, ".cache", "a"), filepath.Join(home, ".cache", "b")},
+	}
+	generated := learnedPresetYAML("tool", paths, entries, cwd, home)
+	wantComment := "      # the directory, to create or remove $HOME/.cache/a, $HOME/.cache/b\n      - \"$HOME/.cache\"\n"
+	if !strings.Contains(generated, wantComment) {
+		t.Errorf("learnedPresetYAML() =\n%s\nwant it to contain\n%s", generated, wantComment)
+	}
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte(generated), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("generated preset does not load: %v", err)
+	}
+	preset, ok := config.GetPreset("tool")
+	if !ok {
+		t.Fatal("preset tool not found")
+	}
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"build", filepath.Join(home, ".cache"), "/tmp"}
+	var got []string
+	for _, allow := range processed.Allow {
+		got = append(got, allow.Path)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Allow = %v, want %v", got, want)
+	}
+}
+
+func TestLearnedPresetYAMLEmpty(t *testing.T) {
+	want := "presets:\n  tool:\n    allow: []\n"
+	if got := learnedPresetYAML("tool", nil, nil, "/home/user", "/home/user"); got != want {
+		t.Errorf("learnedPresetYAML() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LimitsConfig configures resource limits in a preset
+// Sizes accept K, M, G and T suffixes, and CPU time accepts seconds or durations such as "5m"
+type LimitsConfig struct {
+	// AS is the maximum size of the address space of each process
+	AS string `yaml:"as"`
+	// CPU is the maximum CPU time of each process
+	CPU string `yaml:"cpu"`
+	// FSize is the maximum size of files the command can write
+	FSize string `yaml:"fsize"`
+	// NProc is the maximum number of processes of the user
+	NProc string `yaml:"nproc"`
+	// Core is the maximum size of core dumps
+	Core string `yaml:"core"`
+}
+
+// ResourceLimits are resource limits applied to the command with setrlimit
+// A nil field leaves the limit unchanged
+type ResourceLimits struct {
+	// AS is the maximum address space size in bytes
+	AS *uint64
+	// CPU is the maximum CPU time in seconds
+	CPU *uint64
+	// FSize is the maximum file size in bytes
+	FSize *uint64
+	// NProc is the maximum number of processes
+	NProc *uint64
+	// Core is the maximum core dump size in bytes
+	Core *uint64
+}
+
+// resourceLimit is a single resource limit with a description for display
+type resourceLimit struct {
+	name  string
+	value *uint64
+	unit  string
+}
+
+var sizePattern = regexp.MustCompile(`^(\d+)\s*([KMGT]?)(I?B)?$`)
+
+// Parse converts the configured values to resource limits
+func (l LimitsConfig) Parse() (ResourceLimits, error) {
+	var limits ResourceLimits
+	var err error
+	if limits.AS, err = parseLimit("as", l.AS, parseSize); err != nil {
+		return ResourceLimits{}, err
+	}
+	if limits.CPU, err = parseLimit("cpu", l.CPU, parseCPUTime); err != nil {
+		return ResourceLimits{}, err
+	}
+	if limits.FSize, err = parseLimit("fsize", l.FSize, parseSize); err != nil {
+		return ResourceLimits{}, err
+	}
+	if limits.NProc, err = parseLimit("nproc", l.NProc, parseCount); err != nil {
+		return ResourceLimits{}, err
+	}
+	if limits.Core, err = parseLimit("core", l.Core, parseSize); err != nil {
+		return ResourceLimits{}, err
+	}
+	return limits, nil
+}
+
+// parseLimit parses a single limit value, returning nil if it is not set
+func parseLimit(name, value string, parse func(string) (uint64, error)) (*uint64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	v, err := parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s limit %q: %w", name, value, err)
+	}
+	return &v, nil
+}
+
+// parseSize parses a size in bytes with an optional K, M, G or T suffix
+// Suffixes are powers of 1024, and may be followed by "B" or "iB"
+func parseSize(value string) (uint64, error) {
+	m := sizePattern.FindStringSubmatch(strings.ToUpper(value))
+	if m == nil {
+		return 0, fmt.Errorf("expected a size such as 512M or 2G")
+	}
+	n, err := strconv.ParseUint(m[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	shift := strings.Index("KMGT", m[2]) + 1
+	if m[2] == "" {
+		shift = 0
+	}
+	if n > math.MaxUint64>>(10*shift) {
+		return 0, fmt.Errorf("size is too large")
+	}
+	return n << (10 * shift), nil
+}
+
+// parseCPUTime parses CPU time in seconds or as a duration such as "90s" or "5m"
+// Durations are rounded up to whole seconds
+func parseCPUTime(value string) (uint64, error) {
+	if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return n, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("expected seconds or a duration such as 90s or 5m")
+	}
+	return uint64((d + time.Second - 1) / time.Second), nil
+}
+
+// parseCount parses a plain number
+func parseCount(value string) (uint64, error) {
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected a number")
+	}
+	return n, nil
+}
+
+// Min returns the lower of the two values for each limit
+func (r ResourceLimits) Min(other ResourceLimits) ResourceLimits {
+	return ResourceLimits{
+		AS:    minLimit(r.AS, other.AS),
+		CPU:   minLimit(r.CPU, other.CPU),
+		FSize: minLimit(r.FSize, other.FSize),
+		NProc: minLimit(r.NProc, other.NProc),
+		Core:  minLimit(r.Core, other.Core),
+	}
+}
+
+// Override returns the limits with every limit set in other replacing the current value
+func (r ResourceLimits) Override(other ResourceLimits) ResourceLimits {
+	return ResourceLimits{
+		AS:    overrideLimit(other.AS, r.AS),
+		CPU:   overrideLimit(other.CPU, r.CPU),
+		FSize: overrideLimit(other.FSize, r.FSize),
+		NProc: overrideLimit(other.NProc, r.NProc),
+		Core:  overrideLimit(other.Core, r.Core),
+	}
+}
+
+// IsSet reports whether any limit is set
+func (r ResourceLimits) IsSet() bool {
+	return r.AS != nil || r.CPU != nil || r.FSize != nil || r.NProc != nil || r.Core != nil
+}
+
+// entries returns the limits with descriptions, in a fixed order
+func (r ResourceLimits) entries() []resourceLimit {
+	return []resourceLimit{
+		{name: "address space", value: r.AS, unit: "bytes"},
+		{name: "CPU time", value: r.CPU, unit: "seconds"},
+		{name: "file size", value: r.FSize, unit: "bytes"},
+		{name: "processes", value: r.NProc, unit: ""},
+		{name: "core dump size", value: r.Core, unit: "bytes"},
+	}
+}
+
+func minLimit(a, b *uint64) *uint64 {
+	if a == nil {
+		return b
+	}
+	if b == nil || *a <= *b {
+		return a
+	}
+	return b
+}
+
+func overrideLimit(a, b *uint64) *uint64 {
+	if a != nil {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func ptr(v uint64) *uint64 {
+	return &v
+}
+
+func TestLimitsConfigParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  LimitsConfig
+		want    ResourceLimits
+		wantErr bool
+	}{
+		{
+			name:   "empty",
+			config: LimitsConfig{},
+			want:   ResourceLimits{},
+		},
+		{
+			name: "sizes with suffixes",
+			config: LimitsConfig{
+				AS:    "4G",
+				FSize: "512MiB",
+				Core:  "0",
+			},
+			want: ResourceLimits{
+				AS:    ptr(4 << 30),
+				FSize: ptr(512 << 20),
+				Core:  ptr(0),
+			},
+		},
+		{
+			name:   "lowercase suffix and bytes",
+			config: LimitsConfig{AS: "64k", FSize: "1024"},
+			want:   ResourceLimits{AS: ptr(64 << 10), FSize: ptr(1024)},
+		},
+		{
+			name:   "CPU time in seconds",
+			config: LimitsConfig{CPU: "90"},
+			want:   ResourceLimits{CPU: ptr(90)},
+		},
+		{
+			name:   "CPU time as duration",
+			config: LimitsConfig{CPU: "1m30s"},
+			want:   ResourceLimits{CPU: ptr(90)},
+		},
+		{
+			name:   "CPU time rounded up",
+			config: LimitsConfig{CPU: "1500ms"},
+			want:   ResourceLimits{CPU: ptr(2)},
+		},
+		{
+			name:   "process count",
+			config: LimitsConfig{NProc: "256"},
+			want:   ResourceLimits{NProc: ptr(256)},
+		},
+		{
+			name:    "invalid size",
+			config:  LimitsConfig{AS: "lots"},
+			wantErr: true,
+		},
+		{
+			name:    "size overflow",
+			config:  LimitsConfig{FSize: "99999999999T"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid CPU time",
+			config:  LimitsConfig{CPU: "-5s"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid process count",
+			config:  LimitsConfig{NProc: "1K"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.Parse()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceLimitsMerge(t *testing.T) {
+	preset1 := ResourceLimits{AS: ptr(4 << 30), CPU: ptr(600)}
+	preset2 := ResourceLimits{AS: ptr(2 << 30), NProc: ptr(100)}
+	flags := ResourceLimits{AS: ptr(8 << 30)}
+
+	merged := ResourceLimits{}.Min(preset1).Min(preset2)
+	want := ResourceLimits{AS: ptr(2 << 30), CPU: ptr(600), NProc: ptr(100)}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("Min() = %+v, want %+v", merged, want)
+	}
+
+	merged = merged.Override(flags)
+	want = ResourceLimits{AS: ptr(8 << 30), CPU: ptr(600), NProc: ptr(100)}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("Override() = %+v, want %+v", merged, want)
+	}
+}
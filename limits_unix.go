@@ -0,0 +1,43 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// applyResourceLimits sets the resource limits of the current process
+// They are inherited by the command when it is executed
+// Both the soft and the hard limit are set so that the command cannot raise them again
+func applyResourceLimits(limits ResourceLimits) error {
+	resources := []struct {
+		name     string
+		resource int
+		value    *uint64
+	}{
+		{name: "as", resource: unix.RLIMIT_AS, value: limits.AS},
+		{name: "cpu", resource: unix.RLIMIT_CPU, value: limits.CPU},
+		{name: "fsize", resource: unix.RLIMIT_FSIZE, value: limits.FSize},
+		{name: "nproc", resource: unix.RLIMIT_NPROC, value: limits.NProc},
+		{name: "core", resource: unix.RLIMIT_CORE, value: limits.Core},
+	}
+
+	for _, r := range resources {
+		if r.value == nil {
+			continue
+		}
+
+		var current unix.Rlimit
+		if err := unix.Getrlimit(r.resource, &current); err != nil {
+			return fmt.Errorf("get %s limit: %w", r.name, err)
+		}
+		// The hard limit cannot be raised without privileges
+		limit := min(*r.value, current.Max)
+		if err := unix.Setrlimit(r.resource, &unix.Rlimit{Cur: limit, Max: limit}); err != nil {
+			return fmt.Errorf("set %s limit: %w", r.name, err)
+		}
+	}
+	return nil
+}
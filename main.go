@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"os"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const inCageEnv = "IN_CAGE"
@@ -29,11 +31,28 @@ type flags struct {
 	allowKeychain bool
 	allowGit      bool
 	allowPaths    []string
+	readPaths     []string
+	execPaths     []string
+	allowConnect  []uint16
+	allowBind     []uint16
+	noNetwork     bool
+	allowHosts    []string
+	scopeSignals  bool
+	scopeSockets  bool
 	presets       []string
 	listPresets   bool
-	configPath    string
+	configPaths   []string
 	version       bool
 	dryRun        bool
+	requireABI    int
+	strict        bool
+	limits        LimitsConfig
+	cgroup        bool
+	env           EnvConfig
+	policyFile    string
+	supervise     bool
+	timeout       time.Duration
+	interactive   bool
 }
 
 func parseFlags() (*flags, []string) {
@@ -68,6 +87,90 @@ func parseFlags() (*flags, []string) {
 		"Grant write access to specific paths (can be used multiple times)",
 	)
 
+	// Custom flag parsing to handle multiple --read-only flags
+	var readFlags arrayFlags
+	flag.Var(
+		&readFlags,
+		"read-only",
+		"Grant read access to specific paths and deny reads elsewhere (can be used multiple times)",
+	)
+
+	// Custom flag parsing to handle multiple --allow-exec flags
+	var execFlags arrayFlags
+	flag.Var(
+		&execFlags,
+		"allow-exec",
+		"Allow executing files under specific paths and deny execution elsewhere (can be used multiple times)",
+	)
+
+	// Custom flag parsing to handle multiple --allow-connect flags
+	var connectFlags portFlags
+	flag.Var(
+		&connectFlags,
+		"allow-connect",
+		"Allow outgoing TCP connections to a port (can be used multiple times)",
+	)
+
+	// Custom flag parsing to handle multiple --allow-bind flags
+	var bindFlags portFlags
+	flag.Var(
+		&bindFlags,
+		"allow-bind",
+		"Allow binding TCP sockets to a port (can be used multiple times)",
+	)
+
+	flag.BoolVar(
+		&f.noNetwork,
+		"no-network",
+		false,
+		"Deny all network access except loopback",
+	)
+
+	// Custom flag parsing to handle multiple --allow-host flags
+	var hostFlags arrayFlags
+	flag.Var(
+		&hostFlags,
+		"allow-host",
+		"Allow HTTP(S) access to a host through the built-in proxy and deny other network access (can be used multiple times)",
+	)
+
+	flag.BoolVar(
+		&f.scopeSignals,
+		"scope-signals",
+		false,
+		"Deny sending signals to processes outside the sandbox",
+	)
+
+	flag.BoolVar(
+		&f.scopeSockets,
+		"scope-abstract-sockets",
+		false,
+		"Deny connecting to abstract Unix sockets outside the sandbox (only for Linux)",
+	)
+
+	// Custom flag parsing to handle multiple --env flags
+	var envFlags arrayFlags
+	flag.Var(
+		&envFlags,
+		"env",
+		"Set an environment variable with NAME=VALUE, or always pass variables matching a pattern (can be used multiple times)",
+	)
+
+	// Custom flag parsing to handle multiple --unset-env flags
+	var unsetEnvFlags arrayFlags
+	flag.Var(
+		&unsetEnvFlags,
+		"unset-env",
+		"Remove environment variables matching a pattern (can be used multiple times)",
+	)
+
+	flag.BoolVar(
+		&f.env.Safe,
+		"safe-env",
+		false,
+		"Remove environment variables that commonly hold secrets, such as *TOKEN* and SSH_AUTH_SOCK",
+	)
+
 	// Custom flag parsing to handle multiple --preset flags
 	var presetFlags arrayFlags
 	flag.Var(
@@ -76,6 +179,13 @@ func parseFlags() (*flags, []string) {
 		"Use a predefined preset configuration (can be used multiple times)",
 	)
 
+	flag.StringVar(
+		&f.policyFile,
+		"policy-file",
+		"",
+		"Write the effective policy to a file and export its path in CAGE_POLICY_FILE instead of CAGE_POLICY",
+	)
+
 	flag.BoolVar(
 		&f.listPresets,
 		"list-presets",
@@ -83,11 +193,11 @@ func parseFlags() (*flags, []string) {
 		"List available presets",
 	)
 
-	flag.StringVar(
-		&f.configPath,
+	var configFlags arrayFlags
+	flag.Var(
+		&configFlags,
 		"config",
-		"",
-		"Path to custom configuration file",
+		"Path to a configuration file merged over the system and user configuration (can be used multiple times)",
 	)
 
 	flag.BoolVar(
@@ -104,11 +214,107 @@ func parseFlags() (*flags, []string) {
 		"Show the generated sandbox profile without executing",
 	)
 
+	flag.IntVar(
+		&f.requireABI,
+		"require-abi",
+		0,
+		"Refuse to run unless the kernel supports at least this Landlock ABI version (only for Linux)",
+	)
+
+	flag.StringVar(
+		&f.limits.AS,
+		"limit-as",
+		"",
+		"Limit the address space of each process, e.g. 4G",
+	)
+
+	flag.StringVar(
+		&f.limits.CPU,
+		"limit-cpu",
+		"",
+		"Limit the CPU time of each process in seconds or as a duration, e.g. 10m",
+	)
+
+	flag.StringVar(
+		&f.limits.FSize,
+		"limit-fsize",
+		"",
+		"Limit the size of files the command can write, e.g. 1G",
+	)
+
+	flag.StringVar(
+		&f.limits.NProc,
+		"limit-nproc",
+		"",
+		"Limit the number of processes of the user",
+	)
+
+	flag.StringVar(
+		&f.limits.Core,
+		"limit-core",
+		"",
+		"Limit the size of core dumps, e.g. 0 to disable them",
+	)
+
+	flag.BoolVar(
+		&f.cgroup,
+		"cgroup",
+		false,
+		"Run the command in its own cgroup and report its peak memory and CPU usage (only for Linux)",
+	)
+
+	flag.BoolVar(
+		&f.supervise,
+		"supervise",
+		false,
+		"Run the command as a child process of cage instead of replacing cage with it",
+	)
+
+	flag.BoolVar(
+		&f.interactive,
+		"interactive",
+		false,
+		"Ask on the terminal whether to allow writes outside the allowed paths (only for Linux)",
+	)
+
+	flag.DurationVar(
+		&f.timeout,
+		"timeout",
+		0,
+		"Terminate the command if it runs longer than this duration, e.g. 10m",
+	)
+
+	flag.BoolVar(
+		&f.strict,
+		"strict",
+		false,
+		"Refuse to run if any restriction cannot be enforced by the kernel (only for Linux)",
+	)
+
 	flag.Parse()
 
 	f.allowPaths = []string(allowFlags)
+	f.configPaths = []string(configFlags)
+	f.readPaths = []string(readFlags)
+	f.execPaths = []string(execFlags)
+	f.allowConnect = []uint16(connectFlags)
+	f.allowBind = []uint16(bindFlags)
+	f.allowHosts = []string(hostFlags)
 	f.presets = []string(presetFlags)
 
+	// NAME=VALUE sets a variable, and anything else is a pattern of variables to pass
+	for _, value := range envFlags {
+		if name, v, ok := strings.Cut(value, "="); ok {
+			if f.env.Set == nil {
+				f.env.Set = make(map[string]string)
+			}
+			f.env.Set[name] = v
+		} else {
+			f.env.Allow = append(f.env.Allow, value)
+		}
+	}
+	f.env.Deny = []string(unsetEnvFlags)
+
 	return f, flag.Args()
 }
 
@@ -124,13 +330,63 @@ func (a *arrayFlags) Set(value string) error {
 	return nil
 }
 
+// portFlags is a custom flag type that accumulates TCP port numbers
+type portFlags []uint16
+
+func (p *portFlags) String() string {
+	ports := make([]string, 0, len(*p))
+	for _, port := range *p {
+		ports = append(ports, strconv.Itoa(int(port)))
+	}
+	return strings.Join(ports, ", ")
+}
+
+func (p *portFlags) Set(value string) error {
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", value)
+	}
+	*p = append(*p, uint16(port))
+	return nil
+}
+
 func main() {
+	// Subcommands run in the current environment, so they are handled before it is modified
+	// They are only recognized as the first argument, so "cage -- status" still runs a program named status
+	var learnOpts *learnOptions
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "learn":
+			// learn takes the regular flags in addition to its own
+			learnOpts = registerLearnFlags()
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "status":
+			if err := runStatus(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		case "config":
+			if err := runConfig(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+	}
+
 	// Indicate that we are running inside a cage
 	if err := os.Setenv(inCageEnv, "1"); err != nil {
 		fmt.Fprintf(os.Stderr, "cage: error setting environment variable %s: %v\n", inCageEnv, err)
 		os.Exit(1)
 	}
 
+	// Count nested cages so that the command can tell how deeply it is sandboxed
+	if err := os.Setenv(cageDepthEnv, strconv.Itoa(currentDepth()+1)); err != nil {
+		fmt.Fprintf(os.Stderr, "cage: error setting environment variable %s: %v\n", cageDepthEnv, err)
+		os.Exit(1)
+	}
+
 	flags, args := parseFlags()
 
 	// Handle version flag
@@ -140,7 +396,7 @@ func main() {
 	}
 
 	// Load configuration
-	config, err := loadConfig(flags.configPath)
+	config, err := loadConfigFiles(configFiles(flags.configPaths))
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "cage: error loading config: %v\n", err)
 		os.Exit(1)
@@ -154,7 +410,16 @@ func main() {
 		} else {
 			fmt.Println("Available presets:")
 			for _, name := range presets {
-				fmt.Printf("  - %s\n", name)
+				// Show the presets applied before this one
+				ancestry, err := config.ResolvePresets([]string{name})
+				switch {
+				case err != nil:
+					fmt.Printf("  - %s (error: %v)\n", name, err)
+				case len(ancestry) > 1:
+					fmt.Printf("  - %s (extends %s)\n", name, strings.Join(ancestry[:len(ancestry)-1], ", "))
+				default:
+					fmt.Printf("  - %s\n", name)
+				}
 			}
 		}
 		os.Exit(0)
@@ -166,27 +431,44 @@ func main() {
 			os.Stderr,
 			"       cage [flags] -- <command> [command-flags] [command-args...]\n",
 		)
+		fmt.Fprintf(os.Stderr, "       cage learn [flags] -- <command> [command-args...]\n")
+		fmt.Fprintf(os.Stderr, "       cage status [-json]\n")
+		fmt.Fprintf(os.Stderr, "       cage config show [-origin] [-config path]\n")
+		fmt.Fprintf(os.Stderr, "       cage config validate [-config path] [file...]\n")
+		fmt.Fprintf(os.Stderr, "       cage config trust|untrust [path]\n")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
 	// Auto-detect presets and merge with command-line presets
-	if len(config.AutoPresets) > 0 {
-		autoPresets, err := config.GetAutoPresets(args[0])
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "cage: error detecting auto-presets: %v\n", err)
-			os.Exit(1)
-		}
-
-		// Merge auto-detected presets with command-line presets
-		// Command-line presets come first to maintain priority
-		flags.presets = append(flags.presets, autoPresets...)
+	// Command-line presets come first to maintain priority, and presets are preceded by the presets they extend
+	flags.presets, err = config.ResolveCommandPresets(flags.presets, args[0], args[1:]...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+		os.Exit(1)
 	}
 
 	// Merge preset paths with command-line paths
 	allowedPaths := flags.allowPaths
+	createPaths := make(map[string]string)
+	readPaths := flags.readPaths
+	execPaths := flags.execPaths
 	allowKeychain := flags.allowKeychain
 	allowGit := flags.allowGit
+	allowConnect := flags.allowConnect
+	allowBind := flags.allowBind
+	noNetwork := flags.noNetwork
+	allowHosts := flags.allowHosts
+	scopeSignals := flags.scopeSignals
+	scopeSockets := flags.scopeSockets
+	minABI := flags.requireABI
+	var denySyscalls, allowSyscalls []string
+	killOnDeniedSyscall := false
+	var limits ResourceLimits
+	useCgroup := flags.cgroup
+	var cgroupLimits CgroupLimits
+	var env EnvConfig
+	var timeout time.Duration
 
 	// Process each preset and merge their settings
 	for _, presetName := range flags.presets {
@@ -206,8 +488,68 @@ func main() {
 		// Add preset paths
 		for _, path := range processedPreset.Allow {
 			allowedPaths = append(allowedPaths, path.Path)
+			if path.Create != "" {
+				createPaths[path.Path] = path.Create
+			}
+		}
+
+		// Add preset read paths
+		for _, path := range processedPreset.Read {
+			readPaths = append(readPaths, path.Path)
+		}
+
+		// Add preset executable paths
+		for _, path := range processedPreset.Exec {
+			execPaths = append(execPaths, path.Path)
+		}
+
+		// Add preset network rules
+		allowConnect = append(allowConnect, processedPreset.Connect...)
+		allowBind = append(allowBind, processedPreset.Bind...)
+
+		// Preset's network policy is ORed with command-line flag
+		noNetwork = noNetwork || processedPreset.Network.None
+		allowHosts = append(allowHosts, processedPreset.Network.AllowHosts...)
+
+		// Preset's IPC scopes are ORed with command-line flags
+		scopeSignals = scopeSignals || processedPreset.ScopeSignals
+		scopeSockets = scopeSockets || processedPreset.ScopeAbstractSockets
+
+		// The highest minimum ABI version among presets and the command-line flag is required
+		minABI = max(minABI, processedPreset.MinABI)
+
+		// Add preset system call rules
+		// The kill action is used if any preset requests it
+		denySyscalls = append(denySyscalls, processedPreset.Syscalls.Deny...)
+		allowSyscalls = append(allowSyscalls, processedPreset.Syscalls.Allow...)
+		killOnDeniedSyscall = killOnDeniedSyscall ||
+			processedPreset.Syscalls.Action == SyscallActionKill
+
+		// The lowest limit among presets is used
+		presetLimits, err := processedPreset.Limits.Parse()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cage: error processing preset '%s': %v\n", presetName, err)
+			os.Exit(1)
+		}
+		limits = limits.Min(presetLimits)
+
+		// A preset with a cgroup section enables the cgroup mode
+		presetCgroupLimits, err := processedPreset.Cgroup.Parse()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cage: error processing preset '%s': %v\n", presetName, err)
+			os.Exit(1)
+		}
+		cgroupLimits = cgroupLimits.Min(presetCgroupLimits)
+		useCgroup = useCgroup || !processedPreset.Cgroup.IsEmpty()
+
+		// The shortest timeout among presets is used
+		if processedPreset.Timeout > 0 && (timeout == 0 || processedPreset.Timeout < timeout) {
+			timeout = processedPreset.Timeout
 		}
 
+		// Preset environment settings are combined in order
+		env = env.Merge(processedPreset.Env)
+
 		// Preset's allowKeychain is ORed with command-line flag
 		allowKeychain = allowKeychain || processedPreset.AllowKeychain
 
@@ -215,14 +557,67 @@ func main() {
 		allowGit = allowGit || processedPreset.AllowGit
 	}
 
+	// Command-line limits override preset limits
+	flagLimits, err := flags.limits.Parse()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+		os.Exit(1)
+	}
+	limits = limits.Override(flagLimits)
+
+	// The command-line timeout overrides preset timeouts
+	if flags.timeout < 0 {
+		fmt.Fprintf(os.Stderr, "cage: invalid timeout %s: must not be negative\n", flags.timeout)
+		os.Exit(1)
+	}
+	if flags.timeout > 0 {
+		timeout = flags.timeout
+	}
+
+	// Command-line environment settings take precedence over presets
+	env = env.Merge(flags.env)
+	if err := env.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+		os.Exit(1)
+	}
+
+	// The proxy cannot be reached from a private network namespace
+	if noNetwork && len(allowHosts) > 0 {
+		fmt.Fprintf(os.Stderr, "cage: network: none cannot be combined with allowed hosts\n")
+		os.Exit(1)
+	}
+
 	// Create sandbox configuration
 	sandboxConfig := &SandboxConfig{
-		AllowAll:      flags.allowAll,
-		AllowKeychain: allowKeychain,
-		AllowGit:      allowGit,
-		AllowedPaths:  allowedPaths,
-		Command:       args[0],
-		Args:          args[1:],
+		AllowAll:             flags.allowAll,
+		AllowKeychain:        allowKeychain,
+		AllowGit:             allowGit,
+		AllowedPaths:         allowedPaths,
+		CreatePaths:          createPaths,
+		ReadPaths:            readPaths,
+		ExecPaths:            execPaths,
+		AllowConnect:         allowConnect,
+		AllowBind:            allowBind,
+		NoNetwork:            noNetwork,
+		AllowHosts:           allowHosts,
+		ScopeSignals:         scopeSignals,
+		ScopeAbstractSockets: scopeSockets,
+		MinABI:               minABI,
+		Strict:               flags.strict,
+		DenySyscalls:         denySyscalls,
+		AllowSyscalls:        allowSyscalls,
+		KillOnDeniedSyscall:  killOnDeniedSyscall,
+		Limits:               limits,
+		UseCgroup:            useCgroup,
+		CgroupLimits:         cgroupLimits,
+		Env:                  env,
+		Supervise:            flags.supervise,
+		Interactive:          flags.interactive,
+		Timeout:              timeout,
+		Presets:              flags.presets,
+		PolicyFile:           flags.policyFile,
+		Command:              args[0],
+		Args:                 args[1:],
 	}
 
 	// Handle dry-run flag
@@ -230,6 +625,14 @@ func main() {
 		printDryRunAndExit(sandboxConfig)
 	}
 
+	// Trace the command and generate a preset from its writes
+	if learnOpts != nil {
+		if err := runLearn(sandboxConfig, learnOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Execute in sandbox
 	if err := RunInSandbox(sandboxConfig); err != nil {
 		fmt.Fprintf(os.Stderr, "cage: %v\n", err)
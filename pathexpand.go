@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// configDirVar is the built-in variable holding the directory of the configuration file that defines a preset
+const configDirVar = "CAGE_CONFIG_DIR"
+
+// xdgDefaults are the defaults of the XDG base directory variables relative to the home directory,
+// used when the variables are unset or empty
+var xdgDefaults = map[string]string{
+	"XDG_CONFIG_HOME": ".config",
+	"XDG_CACHE_HOME":  ".cache",
+	"XDG_DATA_HOME":   ".local/share",
+	"XDG_STATE_HOME":  ".local/state",
+}
+
+// expandPath expands a path of a preset defined in a configuration file in configDir
+// A leading ~ is replaced by the home directory, and variables are expanded with the syntax
+// $VAR, ${VAR}, ${VAR:-default} to use default if VAR is unset or empty, and ${VAR:?message} to fail then
+// A variable without a default that is not set is an error, as is a path that expands to an empty or root path
+func expandPath(path, configDir string) (string, error) {
+	expanded, err := expandTemplate(path, configDir, true)
+	if err != nil {
+		return "", fmt.Errorf("path %q: %w", path, err)
+	}
+	if expanded == "" {
+		return "", fmt.Errorf("path %q expands to an empty path", path)
+	}
+	if filepath.Clean(expanded) == "/" {
+		return "", fmt.Errorf("path %q expands to the root directory", path)
+	}
+	return expanded, nil
+}
+
+// expandTemplate expands ~ and variables in s
+// ~ is only expanded at the start of a path, which is the start of a default value too
+func expandTemplate(s, configDir string, tilde bool) (string, error) {
+	var b strings.Builder
+	i := 0
+	if tilde && (s == "~" || strings.HasPrefix(s, "~/")) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("expand ~: %w", err)
+		}
+		b.WriteString(home)
+		i = 1
+	}
+
+	for i < len(s) {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		// $VAR
+		if i+1 < len(s) && s[i+1] != '{' {
+			n := variableNameLength(s[i+1:])
+			if n == 0 {
+				// A $ that does not start a variable is kept
+				b.WriteByte('$')
+				i++
+				continue
+			}
+			name := s[i+1 : i+1+n]
+			value, ok := lookupPathVariable(name, configDir)
+			if !ok {
+				return "", fmt.Errorf("variable %s is not set", name)
+			}
+			b.WriteString(value)
+			i += 1 + n
+			continue
+		}
+		if i+1 >= len(s) {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+
+		// ${...} can contain other variables in its default value
+		end := matchingBrace(s, i+1)
+		if end < 0 {
+			return "", fmt.Errorf("missing } after ${")
+		}
+		value, err := expandBraces(s[i+2:end], configDir)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+		i = end + 1
+	}
+	return b.String(), nil
+}
+
+// expandBraces expands the content of ${...}
+func expandBraces(expr, configDir string) (string, error) {
+	n := variableNameLength(expr)
+	if n == 0 {
+		return "", fmt.Errorf("invalid variable ${%s}", expr)
+	}
+	name, op := expr[:n], expr[n:]
+	value, ok := lookupPathVariable(name, configDir)
+
+	switch {
+	case op == "":
+		if !ok {
+			return "", fmt.Errorf("variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(op, ":-"):
+		if ok && value != "" {
+			return value, nil
+		}
+		return expandTemplate(op[2:], configDir, true)
+	case strings.HasPrefix(op, ":?"):
+		if ok && value != "" {
+			return value, nil
+		}
+		message := op[2:]
+		if message == "" {
+			message = "not set"
+		}
+		return "", fmt.Errorf("%s: %s", name, message)
+	}
+	return "", fmt.Errorf("invalid variable ${%s}: only ${VAR:-default} and ${VAR:?message} are supported", expr)
+}
+
+// lookupPathVariable returns the value of a variable in a path
+// The XDG base directory variables fall back to their defaults, and CAGE_CONFIG_DIR is the directory of the configuration file
+func lookupPathVariable(name, configDir string) (string, bool) {
+	if name == configDirVar {
+		return configDir, configDir != ""
+	}
+	value, ok := os.LookupEnv(name)
+	if dir, isXDG := xdgDefaults[name]; isXDG && value == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		return filepath.Join(home, dir), true
+	}
+	return value, ok
+}
+
+// variableNameLength returns the length of the variable name at the start of s
+func variableNameLength(s string) int {
+	for i, c := range s {
+		isLetter := c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+		if !isLetter && (i == 0 || c < '0' || c > '9') {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// matchingBrace returns the index of the } closing the { at start, or -1 if there is none
+func matchingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
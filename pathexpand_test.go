@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CAGE_TEST_DIR", "/opt/data")
+	t.Setenv("CAGE_TEST_EMPTY", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("XDG_DATA_HOME", "/data")
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain path", path: "/usr/local", want: "/usr/local"},
+		{name: "relative path", path: "node_modules", want: "node_modules"},
+		{name: "tilde", path: "~/.npm", want: filepath.Join(home, ".npm")},
+		{name: "tilde only", path: "~", want: home},
+		{name: "tilde in the middle", path: "/a/~/b", want: "/a/~/b"},
+		{name: "variable", path: "$CAGE_TEST_DIR/cache", want: "/opt/data/cache"},
+		{name: "variable with braces", path: "${CAGE_TEST_DIR}cache", want: "/opt/datacache"},
+		{name: "unset variable", path: "$CAGE_TEST_UNSET/cache", wantErr: true},
+		{name: "unset variable with braces", path: "${CAGE_TEST_UNSET}/cache", wantErr: true},
+		{name: "default for unset variable", path: "${CAGE_TEST_UNSET:-/tmp}/cache", want: "/tmp/cache"},
+		{name: "default for empty variable", path: "${CAGE_TEST_EMPTY:-/tmp}/cache", want: "/tmp/cache"},
+		{name: "default not used", path: "${CAGE_TEST_DIR:-/tmp}/cache", want: "/opt/data/cache"},
+		{name: "default with tilde", path: "${CAGE_TEST_UNSET:-~/tmp}", want: filepath.Join(home, "tmp")},
+		{name: "nested default", path: "${CAGE_TEST_UNSET:-${CAGE_TEST_DIR}/x}", want: "/opt/data/x"},
+		{name: "error for unset variable", path: "${CAGE_TEST_UNSET:?set it to the cache}/cache", wantErr: true},
+		{name: "error not used", path: "${CAGE_TEST_DIR:?set it}/cache", want: "/opt/data/cache"},
+		{name: "xdg default", path: "${XDG_CACHE_HOME}/go-build", want: filepath.Join(home, ".cache", "go-build")},
+		{name: "xdg from environment", path: "$XDG_DATA_HOME/app", want: "/data/app"},
+		{name: "xdg state default", path: "$XDG_STATE_HOME", want: filepath.Join(home, ".local", "state")},
+		{name: "config dir", path: "${CAGE_CONFIG_DIR}/out", want: "/etc/cage/out"},
+		{name: "literal dollar", path: "/a/$/b", want: "/a/$/b"},
+		{name: "unsupported operator", path: "${CAGE_TEST_DIR:=x}", wantErr: true},
+		{name: "missing brace", path: "${CAGE_TEST_DIR/cache", wantErr: true},
+		{name: "empty", path: "${CAGE_TEST_EMPTY}", wantErr: true},
+		{name: "root", path: "${CAGE_TEST_EMPTY}/", wantErr: true},
+		{name: "root by default", path: "${CAGE_TEST_UNSET:-/}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandPath(tt.path, "/etc/cage")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandPath(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("expandPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandPathWithoutConfigDir(t *testing.T) {
+	if _, err := expandPath("${CAGE_CONFIG_DIR}/out", ""); err == nil {
+		t.Error("expandPath() expected error for a preset that is not defined in a file")
+	}
+}
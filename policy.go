@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Environment variables that describe the sandbox to the command
+const (
+	// cageDepthEnv is the number of nested cage invocations
+	cageDepthEnv = "CAGE_DEPTH"
+	// cagePolicyEnv contains the effective policy as JSON
+	cagePolicyEnv = "CAGE_POLICY"
+	// cagePolicyFileEnv is the path to a file containing the effective policy as JSON
+	cagePolicyFileEnv = "CAGE_POLICY_FILE"
+)
+
+// cageEnvVars are the environment variables set by cage
+// They are passed to the command regardless of the environment settings
+var cageEnvVars = []string{inCageEnv, cageDepthEnv, cagePolicyEnv, cagePolicyFileEnv}
+
+// policyVersion is the version of the policy JSON format
+// It is incremented when fields are removed or their meaning changes
+const policyVersion = 1
+
+// Policy is the effective policy exported to the command
+type Policy struct {
+	Version int `json:"version"`
+	// Depth is the nesting level of this cage, starting at 1
+	Depth int `json:"depth"`
+	// Presets are the names of the applied presets, including auto-presets
+	Presets []string `json:"presets"`
+	// AllowAll is true if all restrictions are disabled
+	AllowAll bool `json:"allow-all"`
+	// Write are paths with write access
+	Write []string `json:"write"`
+	// Read are paths with read access, or empty if reads are not restricted
+	Read []string `json:"read"`
+	// Exec are paths where execution is allowed, or empty if execution is not restricted
+	Exec    []string      `json:"exec"`
+	Network PolicyNetwork `json:"network"`
+	// Flags are the boolean options in effect
+	Flags PolicyFlags `json:"flags"`
+}
+
+// PolicyNetwork is the network part of the exported policy
+type PolicyNetwork struct {
+	// None is true if only loopback is reachable
+	None bool `json:"none"`
+	// Connect are TCP ports the command may connect to, or empty if connections are not restricted
+	Connect []uint16 `json:"connect"`
+	// Bind are TCP ports the command may bind to
+	Bind []uint16 `json:"bind"`
+	// AllowHosts are hosts reachable through the built-in proxy
+	AllowHosts []string `json:"allow-hosts"`
+}
+
+// PolicyFlags are the boolean options of the exported policy
+type PolicyFlags struct {
+	AllowKeychain        bool `json:"allow-keychain"`
+	AllowGit             bool `json:"allow-git"`
+	Strict               bool `json:"strict"`
+	ScopeSignals         bool `json:"scope-signals"`
+	ScopeAbstractSockets bool `json:"scope-abstract-sockets"`
+	SafeEnv              bool `json:"safe-env"`
+	Cgroup               bool `json:"cgroup"`
+	Supervise            bool `json:"supervise"`
+	Interactive          bool `json:"interactive"`
+}
+
+// currentDepth returns the nesting level of the current cage from CAGE_DEPTH
+// It is 0 outside of cage
+func currentDepth() int {
+	depth, err := strconv.Atoi(os.Getenv(cageDepthEnv))
+	if err != nil || depth < 0 {
+		return 0
+	}
+	return depth
+}
+
+// newPolicy builds the policy exported to the command from the sandbox configuration
+func newPolicy(config *SandboxConfig) Policy {
+	return Policy{
+		Version:  policyVersion,
+		Depth:    currentDepth(),
+		Presets:  nonNil(config.Presets),
+		AllowAll: config.AllowAll,
+		Write:    nonNil(config.AllowedPaths),
+		Read:     nonNil(config.ReadPaths),
+		Exec:     nonNil(config.ExecPaths),
+		Network: PolicyNetwork{
+			None:       config.NoNetwork,
+			Connect:    nonNil(config.AllowConnect),
+			Bind:       nonNil(config.AllowBind),
+			AllowHosts: nonNil(config.AllowHosts),
+		},
+		Flags: PolicyFlags{
+			AllowKeychain:        config.AllowKeychain,
+			AllowGit:             config.AllowGit,
+			Strict:               config.Strict,
+			ScopeSignals:         config.ScopeSignals,
+			ScopeAbstractSockets: config.ScopeAbstractSockets,
+			SafeEnv:              config.Env.Safe,
+			Cgroup:               config.UseCgroup,
+			Supervise:            config.Supervise,
+			Interactive:          config.Interactive,
+		},
+	}
+}
+
+// exportPolicy sets CAGE_POLICY, or writes the policy to PolicyFile and sets CAGE_POLICY_FILE
+// Variables inherited from an outer cage are replaced
+func exportPolicy(config *SandboxConfig) error {
+	data, err := json.Marshal(newPolicy(config))
+	if err != nil {
+		return fmt.Errorf("encode policy: %w", err)
+	}
+
+	if config.PolicyFile == "" {
+		os.Unsetenv(cagePolicyFileEnv)
+		return os.Setenv(cagePolicyEnv, string(data))
+	}
+
+	path, err := filepath.Abs(config.PolicyFile)
+	if err != nil {
+		return fmt.Errorf("resolve policy file path: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write policy file: %w", err)
+	}
+	// The command must be able to read the policy file
+	if config.RestrictReads() {
+		config.ReadPaths = append(config.ReadPaths, path)
+	}
+	os.Unsetenv(cagePolicyEnv)
+	return os.Setenv(cagePolicyFileEnv, path)
+}
+
+// nonNil returns s, or an empty slice if s is nil, so that it is encoded as [] instead of null
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
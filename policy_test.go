@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCurrentDepth(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{value: "", want: 0},
+		{value: "1", want: 1},
+		{value: "3", want: 3},
+		{value: "-1", want: 0},
+		{value: "invalid", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(cageDepthEnv, tt.value)
+		if got := currentDepth(); got != tt.want {
+			t.Errorf("currentDepth() with %q = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestExportPolicy(t *testing.T) {
+	t.Setenv(cageDepthEnv, "2")
+	t.Setenv(cagePolicyEnv, "")
+	t.Setenv(cagePolicyFileEnv, "/stale/policy.json")
+
+	config := &SandboxConfig{
+		AllowedPaths: []string{"/work"},
+		AllowConnect: []uint16{443},
+		ScopeSignals: true,
+		Presets:      []string{"npm"},
+	}
+	if err := exportPolicy(config); err != nil {
+		t.Fatalf("exportPolicy() error = %v", err)
+	}
+	if _, ok := os.LookupEnv(cagePolicyFileEnv); ok {
+		t.Errorf("%s was not removed", cagePolicyFileEnv)
+	}
+
+	var got Policy
+	if err := json.Unmarshal([]byte(os.Getenv(cagePolicyEnv)), &got); err != nil {
+		t.Fatalf("invalid %s: %v", cagePolicyEnv, err)
+	}
+	want := Policy{
+		Version: policyVersion,
+		Depth:   2,
+		Presets: []string{"npm"},
+		Write:   []string{"/work"},
+		Read:    []string{},
+		Exec:    []string{},
+		Network: PolicyNetwork{
+			Connect:    []uint16{443},
+			Bind:       []uint16{},
+			AllowHosts: []string{},
+		},
+		Flags: PolicyFlags{ScopeSignals: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("policy = %+v, want %+v", got, want)
+	}
+}
+
+func TestExportPolicyFile(t *testing.T) {
+	t.Setenv(cagePolicyEnv, "{}")
+	t.Setenv(cagePolicyFileEnv, "")
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	config := &SandboxConfig{
+		AllowedPaths: []string{"/work"},
+		ReadPaths:    []string{"/src"},
+		PolicyFile:   path,
+	}
+	if err := exportPolicy(config); err != nil {
+		t.Fatalf("exportPolicy() error = %v", err)
+	}
+	if got := os.Getenv(cagePolicyFileEnv); got != path {
+		t.Errorf("%s = %q, want %q", cagePolicyFileEnv, got, path)
+	}
+	if _, ok := os.LookupEnv(cagePolicyEnv); ok {
+		t.Errorf("%s was not removed", cagePolicyEnv)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read policy file: %v", err)
+	}
+	var got Policy
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("invalid policy file: %v", err)
+	}
+	if !reflect.DeepEqual(got.Read, []string{"/src"}) {
+		t.Errorf("Read = %v, want [/src]", got.Read)
+	}
+
+	// The command must be able to read the policy file
+	if !reflect.DeepEqual(config.ReadPaths, []string{"/src", path}) {
+		t.Errorf("ReadPaths = %v, want the policy file to be added", config.ReadPaths)
+	}
+}
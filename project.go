@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// projectConfigName is the name of the configuration file of a project
+const projectConfigName = ".cage.yaml"
+
+// interactivePresetName is the preset in the project configuration
+// that collects the paths allowed with "always" in interactive mode
+const interactivePresetName = "interactive"
+
+// projectConfigPath returns the path of the configuration file of the current project
+// It is the nearest .cage.yaml in the working directory or its parents,
+// or a new one at the root of the git repository or in the working directory
+func projectConfigPath() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("get working directory: %w", err)
+	}
+	if path, ok := findProjectConfig(cwd); ok {
+		return path, nil
+	}
+
+	output, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err == nil {
+		return filepath.Join(strings.TrimSpace(string(output)), projectConfigName), nil
+	}
+	return filepath.Join(cwd, projectConfigName), nil
+}
+
+// findProjectConfig returns the nearest .cage.yaml in dir or its parents
+func findProjectConfig(dir string) (string, bool) {
+	for ; ; dir = filepath.Dir(dir) {
+		path := filepath.Join(dir, projectConfigName)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+		if dir == filepath.Dir(dir) {
+			return "", false
+		}
+	}
+}
+
+// addProjectAllowPaths adds entries to the allow list of the interactive preset in the configuration file at path
+// The file is created if it does not exist, and comments and other settings in it are kept
+func addProjectAllowPaths(path string, entries []AllowPath) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	home, _ := os.UserHomeDir()
+	entries = slices.Clone(entries)
+	for i := range entries {
+		entries[i].Path = presetPath(entries[i].Path, "", home)
+	}
+
+	updated, err := addInteractiveAllowEntries(data, entries)
+	if err != nil {
+		return fmt.Errorf("update %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, updated, 0o644); err != nil {
+		return err
+	}
+
+	// The changes were approved by the user, but a file that was not trusted before must still be reviewed
+	if len(data) > 0 && !isTrusted(path, data) {
+		fmt.Fprintf(os.Stderr, "warning: %s is not trusted, run 'cage config trust' to use it\n", path)
+		return nil
+	}
+	return trustConfig(path, updated)
+}
+
+// addInteractiveAllowEntries adds entries to the allow list of the interactive preset in a configuration file
+// Missing sections are added to the innermost existing mapping
+func addInteractiveAllowEntries(data []byte, entries []AllowPath) ([]byte, error) {
+	if strings.TrimSpace(string(data)) == "" {
+		return []byte(allowEntriesYAML([]string{"presets", interactivePresetName, "allow"}, entries)), nil
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	existing := config.Presets[interactivePresetName].Allow
+	var added []AllowPath
+	for _, entry := range entries {
+		if !slices.ContainsFunc(existing, entry.sameEntry) && !slices.ContainsFunc(added, entry.sameEntry) {
+			added = append(added, entry)
+		}
+	}
+	if len(added) == 0 {
+		return data, nil
+	}
+
+	file, err := parser.ParseBytes(data, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{"presets", interactivePresetName, "allow"}
+	for depth := len(keys); depth >= 0; depth-- {
+		node, err := filterNode(file, keys[:depth])
+		if err != nil {
+			continue
+		}
+		if depth == len(keys) {
+			seq, ok := node.(*ast.SequenceNode)
+			if !ok || seq.IsFlowStyle {
+				return nil, fmt.Errorf("%s is not a block sequence", strings.Join(keys, "."))
+			}
+			src, err := parser.ParseBytes([]byte(allowEntriesYAML(nil, added)), 0)
+			if err != nil {
+				return nil, err
+			}
+			path, err := yaml.PathString("$." + strings.Join(keys, "."))
+			if err != nil {
+				return nil, err
+			}
+			if err := path.MergeFromNode(file, src.Docs[0].Body); err != nil {
+				return nil, err
+			}
+			break
+		}
+		mapping, ok := node.(*ast.MappingNode)
+		if !ok || mapping.IsFlowStyle || len(mapping.Values) == 0 {
+			return nil, fmt.Errorf("%s is not a block mapping", strings.Join(append([]string{"$"}, keys[:depth]...), "."))
+		}
+		indent := mapping.Values[0].Key.GetToken().Position.Column - 1
+		src, err := parser.ParseBytes([]byte(allowEntriesYAML(keys[depth:], added)), 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range mappingValues(src.Docs[0].Body) {
+			value.AddColumn(indent)
+			mapping.Values = append(mapping.Values, value)
+		}
+		break
+	}
+
+	updated := []byte(file.String())
+	if !strings.HasSuffix(string(updated), "\n") {
+		updated = append(updated, '\n')
+	}
+
+	// Make sure that the result is still a valid configuration with the new entries
+	var check Config
+	if err := yaml.Unmarshal(updated, &check); err != nil {
+		return nil, fmt.Errorf("updated configuration is invalid: %w", err)
+	}
+	got := check.Presets[interactivePresetName].Allow
+	for _, entry := range added {
+		if !slices.ContainsFunc(got, entry.sameEntry) {
+			return nil, fmt.Errorf("failed to add %q to the %s preset", entry.Path, interactivePresetName)
+		}
+	}
+	return updated, nil
+}
+
+// filterNode returns the node at the mapping keys in file, or the document body if keys is empty
+func filterNode(file *ast.File, keys []string) (ast.Node, error) {
+	if len(keys) == 0 {
+		if len(file.Docs) == 0 || file.Docs[0].Body == nil {
+			return nil, fmt.Errorf("empty document")
+		}
+		return file.Docs[0].Body, nil
+	}
+	path, err := yaml.PathString("$." + strings.Join(keys, "."))
+	if err != nil {
+		return nil, err
+	}
+	return path.FilterFile(file)
+}
+
+// mappingValues returns the key-value pairs of a mapping node
+func mappingValues(node ast.Node) []*ast.MappingValueNode {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		return n.Values
+	case *ast.MappingValueNode:
+		return []*ast.MappingValueNode{n}
+	}
+	return nil
+}
+
+// sameEntry reports whether an allow entry grants the same as p, as saved in interactive mode
+func (p AllowPath) sameEntry(other AllowPath) bool {
+	return p.Path == other.Path && p.Create == other.Create
+}
+
+// allowEntriesYAML formats entries as a sequence nested in the mapping keys
+func allowEntriesYAML(keys []string, entries []AllowPath) string {
+	var b strings.Builder
+	indent := 0
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s%s:\n", strings.Repeat(" ", indent), key)
+		indent += 2
+	}
+	for _, entry := range entries {
+		if entry.Create == "" {
+			fmt.Fprintf(&b, "%s- %q\n", strings.Repeat(" ", indent), entry.Path)
+			continue
+		}
+		fmt.Fprintf(&b, "%s- path: %q\n", strings.Repeat(" ", indent), entry.Path)
+		fmt.Fprintf(&b, "%s  create: %s\n", strings.Repeat(" ", indent), entry.Create)
+	}
+	return b.String()
+}
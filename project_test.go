@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAddInteractiveAllowEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		entries []AllowPath
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "empty file",
+			input:   "",
+			entries: []AllowPath{{Path: "$HOME/.npmrc"}},
+			want:    "presets:\n  interactive:\n    allow:\n      - \"$HOME/.npmrc\"\n",
+		},
+		{
+			name:    "append to existing allow list",
+			input:   "# project policy\npresets:\n  interactive:\n    allow:\n      - \"/tmp\" # scratch\n",
+			entries: []AllowPath{{Path: "/var/tmp"}, {Path: "/tmp"}},
+			want:    "# project policy\npresets:\n  interactive:\n    allow:\n      - \"/tmp\" # scratch\n      - \"/var/tmp\"\n",
+		},
+		{
+			name:    "add allow to existing preset",
+			input:   "presets:\n  interactive:\n    allow-git: true\n",
+			entries: []AllowPath{{Path: "/tmp"}},
+			want:    "presets:\n  interactive:\n    allow-git: true\n    allow:\n      - \"/tmp\"\n",
+		},
+		{
+			name:    "add preset next to other presets",
+			input:   "presets:\n  # build output\n  build:\n    allow:\n      - \"out\"\nauto-presets: []\n",
+			entries: []AllowPath{{Path: "/tmp"}},
+			want:    "presets:\n  # build output\n  build:\n    allow:\n      - \"out\"\n  interactive:\n    allow:\n      - \"/tmp\"\nauto-presets: []\n",
+		},
+		{
+			name:    "add presets section",
+			input:   "auto-presets: []\n",
+			entries: []AllowPath{{Path: "/tmp"}},
+			want:    "auto-presets: []\npresets:\n  interactive:\n    allow:\n      - \"/tmp\"\n",
+		},
+		{
+			name:    "entry created if missing",
+			input:   "presets:\n  interactive:\n    allow:\n      - \"/tmp\"\n",
+			entries: []AllowPath{{Path: "/tmp"}, {Path: "$HOME/.npmrc", Create: AllowCreateFile}},
+			want:    "presets:\n  interactive:\n    allow:\n      - \"/tmp\"\n      - path: \"$HOME/.npmrc\"\n        create: file\n",
+		},
+		{
+			name:    "new preset with an entry created if missing",
+			input:   "",
+			entries: []AllowPath{{Path: "$HOME/.cache", Create: AllowCreateDirectory}},
+			want:    "presets:\n  interactive:\n    allow:\n      - path: \"$HOME/.cache\"\n        create: directory\n",
+		},
+		{
+			name:    "all entries present",
+			input:   "presets:\n  interactive:\n    allow: [\"/tmp\"]\n",
+			entries: []AllowPath{{Path: "/tmp"}},
+			want:    "presets:\n  interactive:\n    allow: [\"/tmp\"]\n",
+		},
+		{
+			name:    "flow style allow list",
+			input:   "presets:\n  interactive:\n    allow: [\"/tmp\"]\n",
+			entries: []AllowPath{{Path: "/var/tmp"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid YAML",
+			input:   "presets: [\n",
+			entries: []AllowPath{{Path: "/tmp"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := addInteractiveAllowEntries([]byte(tt.input), tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addInteractiveAllowEntries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("addInteractiveAllowEntries() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProjectConfigPath(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(root, projectConfigName)
+	if err := os.WriteFile(configPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(sub)
+
+	got, err := projectConfigPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := filepath.EvalSymlinks(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("projectConfigPath() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"slices"
+	"strings"
+	"time"
+)
+
+// proxyEnvVars are the environment variables that point HTTP clients to the egress proxy
+var proxyEnvVars = []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"}
+
+// egressProxy is an HTTP proxy that only forwards requests to allowed hosts
+// It supports plain HTTP requests and HTTPS through CONNECT tunnels
+type egressProxy struct {
+	allowHosts []string
+	listener   net.Listener
+	server     *http.Server
+	transport  *http.Transport
+	log        io.Writer
+}
+
+// newEgressProxy returns an egress proxy that serves connections once Serve is called
+// Every allowed and denied host is logged to log
+func newEgressProxy(allowHosts []string, log io.Writer) *egressProxy {
+	p := &egressProxy{
+		allowHosts: allowHosts,
+		// Connect to the hosts directly instead of using proxies from the environment
+		transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+			ForceAttemptHTTP2:     true,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+		log: log,
+	}
+	p.server = &http.Server{
+		Handler:           p,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	return p
+}
+
+// startEgressProxy starts an egress proxy listening on a random loopback port
+// Every allowed and denied host is logged to log
+func startEgressProxy(allowHosts []string, log io.Writer) (*egressProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("start proxy: %w", err)
+	}
+	p := newEgressProxy(allowHosts, log)
+	p.Serve(listener)
+	return p, nil
+}
+
+// Serve accepts connections on listener in the background until the proxy is closed
+// The listener can belong to another network namespace, while the proxy connects to hosts from the current one
+func (p *egressProxy) Serve(listener net.Listener) {
+	p.listener = listener
+	go p.server.Serve(listener)
+}
+
+// Port returns the port the proxy listens on
+func (p *egressProxy) Port() uint16 {
+	return uint16(p.listener.Addr().(*net.TCPAddr).Port)
+}
+
+// URL returns the URL to use in proxy environment variables
+func (p *egressProxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+// Close stops the proxy
+func (p *egressProxy) Close() error {
+	p.transport.CloseIdleConnections()
+	return p.server.Close()
+}
+
+func (p *egressProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Hosts without a port are only allowed on the default port of HTTP or HTTPS,
+	// so that CONNECT cannot reach other services on an allowed host
+	hostport, defaultPort := r.Host, "443"
+	if r.Method != http.MethodConnect {
+		if !r.URL.IsAbs() {
+			http.Error(w, "cage: only proxy requests are supported", http.StatusBadRequest)
+			return
+		}
+		// The transport connects to the default port of the scheme
+		switch r.URL.Scheme {
+		case "http":
+			defaultPort = "80"
+		case "https":
+			defaultPort = "443"
+		default:
+			http.Error(w, fmt.Sprintf("cage: unsupported scheme %q", r.URL.Scheme), http.StatusBadRequest)
+			return
+		}
+		hostport = r.URL.Host
+	}
+
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host, port = hostport, defaultPort
+	}
+	hostport = net.JoinHostPort(host, port)
+	if !hostAllowed(p.allowHosts, host, port, defaultPort) {
+		fmt.Fprintf(p.log, "cage: proxy denied %s\n", hostport)
+		http.Error(w, fmt.Sprintf("cage: %s is not allowed", hostport), http.StatusForbidden)
+		return
+	}
+	fmt.Fprintf(p.log, "cage: proxy allowed %s\n", hostport)
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, hostport)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		// The outgoing request already has the absolute URL of the target
+		Rewrite:   func(*httputil.ProxyRequest) {},
+		Transport: p.transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Fprintf(p.log, "cage: proxy error for %s: %v\n", hostport, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// tunnel connects the client to hostport for a CONNECT request
+func (p *egressProxy) tunnel(w http.ResponseWriter, hostport string) {
+	upstream, err := net.DialTimeout("tcp", hostport, 30*time.Second)
+	if err != nil {
+		fmt.Fprintf(p.log, "cage: proxy error for %s: %v\n", hostport, err)
+		http.Error(w, fmt.Sprintf("cage: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "cage: tunneling is not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// Forward data the client sent along with the CONNECT request
+		io.Copy(upstream, buf)
+		if tcp, ok := upstream.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, upstream)
+		if tcp, ok := client.(*net.TCPConn); ok {
+			tcp.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// hostAllowed reports whether host and port match one of the allowed hosts
+// A pattern starting with "*." matches any subdomain of the rest of the pattern
+// A pattern with a port, such as "example.com:8443", only matches that port,
+// and a pattern without a port only matches defaultPort
+func hostAllowed(allowHosts []string, host, port, defaultPort string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range allowHosts {
+		patternPort := defaultPort
+		if h, p, err := net.SplitHostPort(pattern); err == nil {
+			pattern, patternPort = h, p
+		}
+		if port != patternPort {
+			continue
+		}
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "."))
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyEnv returns env with the proxy environment variables pointing to proxyURL
+// NO_PROXY is removed because direct connections are denied anyway
+func proxyEnv(env []string, proxyURL string) []string {
+	var result []string
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if slices.Contains(proxyEnvVars, name) || name == "NO_PROXY" || name == "no_proxy" {
+			continue
+		}
+		result = append(result, kv)
+	}
+	for _, name := range proxyEnvVars {
+		result = append(result, name+"="+proxyURL)
+	}
+	return result
+}
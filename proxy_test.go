@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHostAllowed(t *testing.T) {
+	allowHosts := []string{"registry.npmjs.org", "*.github.com", "Example.COM.", "git.example.org:8443", "[::1]:8080"}
+
+	tests := []struct {
+		host string
+		port string
+		want bool
+	}{
+		{host: "registry.npmjs.org", port: "443", want: true},
+		{host: "REGISTRY.npmjs.org", port: "443", want: true},
+		{host: "registry.npmjs.org", port: "22", want: false},
+		{host: "npmjs.org", port: "443", want: false},
+		{host: "evil-registry.npmjs.org", port: "443", want: false},
+		{host: "api.github.com", port: "443", want: true},
+		{host: "raw.objects.github.com", port: "443", want: true},
+		{host: "github.com", port: "443", want: false},
+		{host: "evilgithub.com", port: "443", want: false},
+		{host: "example.com", port: "443", want: true},
+		{host: "example.com.", port: "443", want: true},
+		{host: "git.example.org", port: "8443", want: true},
+		{host: "git.example.org", port: "443", want: false},
+		{host: "::1", port: "8080", want: true},
+		{host: "127.0.0.1", port: "443", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host+":"+tt.port, func(t *testing.T) {
+			if got := hostAllowed(allowHosts, tt.host, tt.port, "443"); got != tt.want {
+				t.Errorf("hostAllowed(%q, %q) = %v, want %v", tt.host, tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyEnv(t *testing.T) {
+	env := []string{
+		"HOME=/home/user",
+		"HTTP_PROXY=http://corp:3128",
+		"no_proxy=localhost",
+		"NO_PROXY=localhost",
+	}
+	want := []string{
+		"HOME=/home/user",
+		"HTTP_PROXY=http://127.0.0.1:8080",
+		"HTTPS_PROXY=http://127.0.0.1:8080",
+		"http_proxy=http://127.0.0.1:8080",
+		"https_proxy=http://127.0.0.1:8080",
+	}
+	if got := proxyEnv(env, "http://127.0.0.1:8080"); !reflect.DeepEqual(got, want) {
+		t.Errorf("proxyEnv() = %v, want %v", got, want)
+	}
+}
+
+// newProxyClient returns an HTTP client that sends all requests through the proxy
+func newProxyClient(t *testing.T, p *egressProxy) *http.Client {
+	t.Helper()
+	proxyURL, err := url.Parse(p.URL())
+	if err != nil {
+		t.Fatalf("parse proxy URL: %v", err)
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyURL(proxyURL),
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+}
+
+func TestEgressProxy(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	})
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+
+	tests := []struct {
+		name       string
+		allowHosts []string
+		// allowServer allows the host and port of the test server
+		allowServer bool
+		wantStatus  int
+		wantLog     string
+	}{
+		{
+			name:        "allowed host",
+			allowServer: true,
+			wantStatus:  http.StatusOK,
+			wantLog:     "cage: proxy allowed 127.0.0.1:",
+		},
+		{
+			name:       "denied host",
+			allowHosts: []string{"example.com"},
+			wantStatus: http.StatusForbidden,
+			wantLog:    "cage: proxy denied 127.0.0.1:",
+		},
+		{
+			name:       "host allowed on another port",
+			allowHosts: []string{"127.0.0.1"},
+			wantStatus: http.StatusForbidden,
+			wantLog:    "cage: proxy denied 127.0.0.1:",
+		},
+	}
+
+	servers := map[string]*httptest.Server{"http": httpServer, "https": tlsServer}
+
+	for _, tt := range tests {
+		for scheme, server := range servers {
+			t.Run(tt.name+" "+scheme, func(t *testing.T) {
+				allowHosts := tt.allowHosts
+				if tt.allowServer {
+					allowHosts = append(allowHosts, server.Listener.Addr().String())
+				}
+
+				var log bytes.Buffer
+				p, err := startEgressProxy(allowHosts, &log)
+				if err != nil {
+					t.Fatalf("startEgressProxy() error = %v", err)
+				}
+				defer p.Close()
+
+				resp, err := newProxyClient(t, p).Get(server.URL)
+				if tt.wantStatus != http.StatusOK {
+					// HTTPS clients report a failed CONNECT as an error
+					if err == nil {
+						defer resp.Body.Close()
+						if resp.StatusCode != tt.wantStatus {
+							t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+						}
+					}
+				} else {
+					if err != nil {
+						t.Fatalf("Get() error = %v", err)
+					}
+					defer resp.Body.Close()
+					body, _ := io.ReadAll(resp.Body)
+					if resp.StatusCode != tt.wantStatus || string(body) != "hello" {
+						t.Errorf("response = %d %q, want %d %q", resp.StatusCode, body, tt.wantStatus, "hello")
+					}
+				}
+
+				if !strings.Contains(log.String(), tt.wantLog) {
+					t.Errorf("log = %q, want it to contain %q", log.String(), tt.wantLog)
+				}
+			})
+		}
+	}
+}
+
+func TestEgressProxyDefaultPort(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		allowHosts []string
+		wantStatus int
+		wantLog    string
+	}{
+		{
+			name:       "https URL is checked on port 443",
+			method:     http.MethodGet,
+			target:     "https://example.com/",
+			allowHosts: []string{"example.com:80"},
+			wantStatus: http.StatusForbidden,
+			wantLog:    "cage: proxy denied example.com:443",
+		},
+		{
+			name:       "unsupported scheme",
+			method:     http.MethodGet,
+			target:     "ftp://example.com/",
+			allowHosts: []string{"example.com"},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "CONNECT without port dials port 443",
+			method:     http.MethodConnect,
+			target:     "127.0.0.1",
+			allowHosts: []string{"127.0.0.1"},
+			wantLog:    "cage: proxy allowed 127.0.0.1:443",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var log bytes.Buffer
+			p := newEgressProxy(tt.allowHosts, &log)
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.method == http.MethodConnect {
+				req.URL = &url.URL{Host: tt.target}
+				req.Host = tt.target
+			}
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+
+			if tt.wantStatus != 0 && rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if !strings.Contains(log.String(), tt.wantLog) {
+				t.Errorf("log = %q, want it to contain %q", log.String(), tt.wantLog)
+			}
+			if strings.Contains(log.String(), "missing port") {
+				t.Errorf("log = %q, want the default port to be dialed", log.String())
+			}
+		})
+	}
+}
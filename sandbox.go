@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"maps"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"slices"
+	"strings"
+	"time"
 )
 
 // SandboxConfig contains the configuration for running a command in a sandbox
@@ -24,6 +27,90 @@ type SandboxConfig struct {
 	// AllowedPaths are paths where write access is granted
 	AllowedPaths []string
 
+	// CreatePaths are allowed paths that are created if they do not exist, mapped to "file" or "directory"
+	// This is only applicable on Linux, where write access can only be granted to existing paths
+	CreatePaths map[string]string
+
+	// ReadPaths are paths where read access is granted
+	// If set, reads are denied everywhere else except for a built-in set of system paths
+	ReadPaths []string
+
+	// ExecPaths are paths where executing files is allowed
+	// If set, execution is denied everywhere else
+	ExecPaths []string
+
+	// MinABI is the minimum Landlock ABI version the kernel must support
+	// This is only applicable on Linux
+	MinABI int
+
+	// Strict refuses to run the command if any restriction cannot be enforced
+	// This is only applicable on Linux
+	Strict bool
+
+	// DenySyscalls are system calls denied in addition to the default denylist
+	// This is only applicable on Linux
+	DenySyscalls []string
+
+	// AllowSyscalls are system calls removed from the default denylist
+	// This is only applicable on Linux
+	AllowSyscalls []string
+
+	// KillOnDeniedSyscall kills the process on a denied system call instead of failing it with EPERM
+	// This is only applicable on Linux
+	KillOnDeniedSyscall bool
+
+	// AllowConnect are TCP ports the command may connect to
+	// Network restrictions are only applied if AllowConnect or AllowBind is set
+	AllowConnect []uint16
+
+	// AllowBind are TCP ports the command may bind to
+	AllowBind []uint16
+
+	// NoNetwork denies all network access except loopback
+	NoNetwork bool
+
+	// AllowHosts are hosts reachable through the built-in HTTP proxy
+	// If set, all other network connections are denied
+	AllowHosts []string
+
+	// ScopeSignals denies sending signals to processes outside the sandbox
+	ScopeSignals bool
+
+	// ScopeAbstractSockets denies connecting to abstract Unix sockets created outside the sandbox
+	// This is only applicable on Linux
+	ScopeAbstractSockets bool
+
+	// Limits are resource limits applied to the command
+	Limits ResourceLimits
+
+	// UseCgroup runs the command in its own cgroup and reports its resource usage
+	// This is only applicable on Linux
+	UseCgroup bool
+
+	// CgroupLimits are limits applied to the cgroup of the command
+	CgroupLimits CgroupLimits
+
+	// Env configures the environment variables passed to the command
+	Env EnvConfig
+
+	// Supervise runs the command as a child process of cage instead of replacing cage with it
+	// cage then forwards signals to the command, waits for it and exits with its status
+	Supervise bool
+
+	// Timeout terminates the command and its process group if it runs longer
+	// A timeout implies Supervise
+	Timeout time.Duration
+
+	// Interactive asks on the terminal whether to allow writes outside the allowed paths
+	// This is only applicable on Linux, and implies Supervise
+	Interactive bool
+
+	// Presets are the names of the applied presets, exported as part of the policy
+	Presets []string
+
+	// PolicyFile is a path to write the policy to instead of exporting it in CAGE_POLICY
+	PolicyFile string
+
 	// Command is the command to execute
 	Command string
 
@@ -32,14 +119,7 @@ type SandboxConfig struct {
 }
 
 func modifySandboxConfig(config *SandboxConfig) {
-	pathSet := make(map[string]struct{})
-	for _, path := range config.AllowedPaths {
-		absPath, err := filepath.Abs(path)
-		if err != nil {
-			absPath = path
-		}
-		pathSet[absPath] = struct{}{}
-	}
+	pathSet := absPathSet(config.AllowedPaths)
 
 	// Add git common directory if allowGit is enabled and not already handled by preset
 	if config.AllowGit {
@@ -53,11 +133,112 @@ func modifySandboxConfig(config *SandboxConfig) {
 	}
 
 	config.AllowedPaths = slices.Sorted(maps.Keys(pathSet))
+	createPaths := make(map[string]string, len(config.CreatePaths))
+	for path, kind := range config.CreatePaths {
+		if absPath, err := filepath.Abs(path); err == nil {
+			path = absPath
+		}
+		createPaths[path] = kind
+	}
+	config.CreatePaths = createPaths
+	config.ReadPaths = slices.Sorted(maps.Keys(absPathSet(config.ReadPaths)))
+	config.ExecPaths = slices.Sorted(maps.Keys(absPathSet(config.ExecPaths)))
+
+	slices.Sort(config.AllowConnect)
+	config.AllowConnect = slices.Compact(config.AllowConnect)
+	slices.Sort(config.AllowBind)
+	config.AllowBind = slices.Compact(config.AllowBind)
+	slices.Sort(config.AllowHosts)
+	config.AllowHosts = slices.Compact(config.AllowHosts)
+
+	// cage has to keep running to enforce the timeout or to ask for permissions
+	if config.Timeout > 0 || (config.Interactive && !config.AllowAll) {
+		config.Supervise = true
+	}
+}
+
+// absPathSet converts paths to absolute paths and removes duplicates
+func absPathSet(paths []string) map[string]struct{} {
+	pathSet := make(map[string]struct{})
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			absPath = path
+		}
+		pathSet[absPath] = struct{}{}
+	}
+	return pathSet
+}
+
+// RestrictReads reports whether read access should be confined to ReadPaths
+func (c *SandboxConfig) RestrictReads() bool {
+	return len(c.ReadPaths) > 0
+}
+
+// RestrictExec reports whether execution should be limited to ExecPaths
+func (c *SandboxConfig) RestrictExec() bool {
+	return len(c.ExecPaths) > 0
+}
+
+// RestrictNetwork reports whether TCP network restrictions should be applied
+func (c *SandboxConfig) RestrictNetwork() bool {
+	return len(c.AllowConnect) > 0 || len(c.AllowBind) > 0
+}
+
+// RestrictHosts reports whether network access should go through the egress proxy
+func (c *SandboxConfig) RestrictHosts() bool {
+	return len(c.AllowHosts) > 0
+}
+
+// Environ returns the environment for the command
+// The environment is passed unchanged if AllowAll is set
+func (c *SandboxConfig) Environ() []string {
+	if c.AllowAll {
+		return os.Environ()
+	}
+	return c.Env.Apply(os.Environ())
 }
 
 // RunInSandbox executes the given command with sandbox restrictions
 // This is implemented differently for each platform
 func RunInSandbox(config *SandboxConfig) error {
 	modifySandboxConfig(config)
+	if err := exportPolicy(config); err != nil {
+		return err
+	}
+	if !config.AllowAll && config.RestrictExec() {
+		if err := checkExecAllowed(config); err != nil {
+			return err
+		}
+	}
 	return runInSandbox(config)
 }
+
+// checkExecAllowed returns an error if the command is outside the executable allowlist
+// The sandbox would deny executing it anyway, but this gives a clearer error message
+func checkExecAllowed(config *SandboxConfig) error {
+	path, err := exec.LookPath(config.Command)
+	if err != nil {
+		return fmt.Errorf("command not found: %w", err)
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("resolve command path: %w", err)
+	}
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("resolve command path: %w", err)
+	}
+
+	for _, execPath := range config.ExecPaths {
+		resolved, err := filepath.EvalSymlinks(execPath)
+		if err != nil {
+			continue
+		}
+		dir := strings.TrimSuffix(resolved, string(filepath.Separator)) + string(filepath.Separator)
+		if path == resolved || strings.HasPrefix(path, dir) {
+			return nil
+		}
+	}
+	return fmt.Errorf("command %s is not in the executable allowlist", path)
+}
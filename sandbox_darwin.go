@@ -4,16 +4,73 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"syscall"
 )
 
+// systemReadPaths are paths that stay readable when reads are confined
+// They cover system frameworks, libraries and basic configuration
+// so that common binaries can still start
+var systemReadPaths = []string{
+	"/System",
+	"/Library/Apple",
+	"/Library/Preferences",
+	"/usr",
+	"/bin",
+	"/sbin",
+	"/opt/homebrew",
+	"/nix/store",
+	"/private/etc",
+	"/private/var/db/timezone",
+	"/private/var/db/dyld",
+	"/dev",
+}
+
+// limitsHelperName is the argv[0] used to re-execute cage as the helper process
+// that applies the resource limits and executes sandbox-exec
+const limitsHelperName = "cage-limits-helper"
+
+func init() {
+	// The helper process is cage itself, started by newLimitsHelperCommand
+	if len(os.Args) > 0 && os.Args[0] == limitsHelperName {
+		if err := runLimitsHelper(os.Args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
 // runInSandbox implements sandbox execution for macOS using sandbox-exec
 func runInSandbox(config *SandboxConfig) error {
+	env := config.Environ()
+
+	if !config.AllowAll && config.UseCgroup {
+		fmt.Fprintf(os.Stderr, "warning: cgroups are only supported on Linux; cgroup limits not enforced\n")
+	}
+	if !config.AllowAll && config.Interactive {
+		fmt.Fprintf(os.Stderr, "warning: interactive mode is only supported on Linux; writes outside the allowed paths are denied\n")
+	}
+
+	// Start the egress proxy and only allow connections to it
+	var proxy *egressProxy
+	if !config.AllowAll && config.RestrictHosts() {
+		var err error
+		proxy, err = startEgressProxy(config.AllowHosts, os.Stderr)
+		if err != nil {
+			return err
+		}
+		defer proxy.Close()
+
+		config.AllowConnect = append(config.AllowConnect, proxy.Port())
+		env = proxyEnv(env, proxy.URL())
+	}
+
 	// Generate sandbox profile
 	profile, err := generateSandboxProfile(config)
 	if err != nil {
@@ -30,8 +87,80 @@ func runInSandbox(config *SandboxConfig) error {
 	args := []string{"sandbox-exec", "-p", profile, config.Command}
 	args = append(args, config.Args...)
 
+	var limits ResourceLimits
+	if !config.AllowAll {
+		limits = config.Limits
+	}
+
+	// The egress proxy and the supervisor must keep running while the command runs,
+	// so sandbox-exec is started as a child process in that case
+	if proxy != nil || config.Supervise {
+		cmd := exec.Command(sandboxPath, args[1:]...)
+		// Resource limits must not apply to cage itself,
+		// so a copy of cage applies them in the child process before executing sandbox-exec
+		if limits != (ResourceLimits{}) {
+			helper, err := newLimitsHelperCommand(limits, sandboxPath, args)
+			if err != nil {
+				return err
+			}
+			cmd = helper
+		}
+		cmd.Env = env
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		sv := newSupervisor(cmd)
+		sv.SetTimeout(config.Timeout)
+		state, err := sv.Run()
+		if err != nil {
+			return fmt.Errorf("failed to run sandbox-exec: %w", err)
+		}
+		if sv.TimedOut() {
+			os.Exit(timeoutExitCode)
+		}
+		exitWithStatus(state)
+		return nil
+	}
+
+	// Resource limits are inherited by sandbox-exec and the command
+	if err := applyResourceLimits(limits); err != nil {
+		return fmt.Errorf("apply resource limits: %w", err)
+	}
+
 	// Replace current process with sandbox-exec
-	return syscall.Exec(sandboxPath, args, os.Environ())
+	return syscall.Exec(sandboxPath, args, env)
+}
+
+// newLimitsHelperCommand returns a command that starts a copy of cage,
+// which applies the resource limits and executes sandbox-exec with args
+func newLimitsHelperCommand(limits ResourceLimits, sandboxPath string, args []string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("find cage executable: %w", err)
+	}
+	encoded, err := json.Marshal(limits)
+	if err != nil {
+		return nil, fmt.Errorf("encode resource limits: %w", err)
+	}
+	cmd := exec.Command(self)
+	cmd.Args = append([]string{limitsHelperName, string(encoded), sandboxPath}, args...)
+	return cmd, nil
+}
+
+// runLimitsHelper runs inside the helper process started by newLimitsHelperCommand
+// Its arguments are the resource limits, the path of sandbox-exec and the arguments of sandbox-exec
+func runLimitsHelper(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("invalid arguments of %s", limitsHelperName)
+	}
+	var limits ResourceLimits
+	if err := json.Unmarshal([]byte(args[0]), &limits); err != nil {
+		return fmt.Errorf("decode resource limits: %w", err)
+	}
+	if err := applyResourceLimits(limits); err != nil {
+		return fmt.Errorf("apply resource limits: %w", err)
+	}
+	return syscall.Exec(args[1], args[2:], os.Environ())
 }
 
 // generateSandboxProfile creates a sandbox-exec profile with write restrictions
@@ -47,6 +176,32 @@ func generateSandboxProfile(config *SandboxConfig) (string, error) {
 		return profile.String(), nil
 	}
 
+	// Deny reads to all paths except the system paths, allowed paths and temporary directories
+	if config.RestrictReads() {
+		profile.WriteString("(deny file-read*)\n")
+		// Metadata is needed to resolve paths, e.g. stat(2) on parent directories
+		profile.WriteString("(allow file-read-metadata)\n")
+		profile.WriteString(
+			`(allow file-read* (regex #"^/private/var/folders/[^/]+/[^/]+/(C|T|0)($|/)"))` + "\n",
+		)
+		readPaths := slices.Concat(systemReadPaths, config.ReadPaths, config.AllowedPaths)
+		for _, path := range readPaths {
+			absPath, err := filepath.Abs(path)
+			if err != nil {
+				absPath = path
+			}
+			fmt.Fprintf(&profile, "(allow file-read* (subpath \"%s\"))\n", escapePathForSandbox(absPath))
+		}
+	}
+
+	// Deny execution except under the executable allowlist
+	if config.RestrictExec() {
+		profile.WriteString("(deny process-exec*)\n")
+		for _, path := range config.ExecPaths {
+			fmt.Fprintf(&profile, "(allow process-exec* (subpath \"%s\"))\n", escapePathForSandbox(path))
+		}
+	}
+
 	// Deny writes to all paths except allowed ones
 	profile.WriteString("(deny file-write*)\n")
 	// allow allow for /private/var/folders
@@ -83,6 +238,42 @@ func generateSandboxProfile(config *SandboxConfig) (string, error) {
 		fmt.Fprintf(&profile, "(allow file-write* (literal \"%s\"))\n", escapedPath)
 	}
 
+	// Deny all network access except localhost and Unix sockets
+	// Name resolution through mDNSResponder is denied as well
+	// With the egress proxy, which runs outside the sandbox, this leaves the proxy as the only way out
+	if config.NoNetwork || config.RestrictHosts() {
+		profile.WriteString("(deny network*)\n")
+		profile.WriteString(`(allow network* (local ip "localhost:*"))` + "\n")
+		profile.WriteString(`(allow network* (remote ip "localhost:*"))` + "\n")
+		profile.WriteString("(allow network* (remote unix-socket))\n")
+		profile.WriteString(
+			`(deny network-outbound (remote unix-socket (path-literal "/private/var/run/mDNSResponder")))` + "\n",
+		)
+	}
+
+	// Restrict TCP networking to the allowed ports
+	// Behind the egress proxy, the allowed ports are only reachable on localhost
+	if config.RestrictNetwork() {
+		remoteHost := "*"
+		if config.RestrictHosts() {
+			remoteHost = "localhost"
+		}
+		profile.WriteString(`(deny network-outbound (remote tcp "*:*"))` + "\n")
+		for _, port := range config.AllowConnect {
+			fmt.Fprintf(&profile, "(allow network-outbound (remote tcp \"%s:%d\"))\n", remoteHost, port)
+		}
+		profile.WriteString(`(deny network-bind (local tcp "*:*"))` + "\n")
+		for _, port := range config.AllowBind {
+			fmt.Fprintf(&profile, "(allow network-bind (local tcp \"*:%d\"))\n", port)
+		}
+	}
+
+	// Deny signals to processes outside the sandbox
+	if config.ScopeSignals {
+		profile.WriteString("(deny signal)\n")
+		profile.WriteString("(allow signal (target same-sandbox))\n")
+	}
+
 	return profile.String(), nil
 }
 
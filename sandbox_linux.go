@@ -3,19 +3,107 @@
 package main
 
 import (
+	"debug/elf"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 	"syscall"
 
 	"github.com/landlock-lsm/go-landlock/landlock"
+	ll "github.com/landlock-lsm/go-landlock/landlock/syscall"
+	"golang.org/x/sys/unix"
+)
+
+// systemReadPaths are paths that stay readable when reads are confined
+// They cover the dynamic loader, shared libraries and basic system configuration
+// so that common binaries can still start
+var systemReadPaths = []string{
+	"/bin",
+	"/sbin",
+	"/usr",
+	"/lib",
+	"/lib32",
+	"/lib64",
+	"/libx32",
+	"/nix/store",
+	"/run/current-system/sw",
+	"/etc/ld.so.cache",
+	"/etc/ld.so.conf",
+	"/etc/ld.so.conf.d",
+	"/etc/alternatives",
+	"/etc/passwd",
+	"/etc/group",
+	"/etc/nsswitch.conf",
+	"/etc/hosts",
+	"/etc/host.conf",
+	"/etc/resolv.conf",
+	"/etc/localtime",
+	"/etc/ssl",
+	"/etc/pki",
+	"/etc/ca-certificates",
+	"/etc/terminfo",
+	"/proc",
+	"/dev/null",
+	"/dev/zero",
+	"/dev/random",
+	"/dev/urandom",
+	"/dev/tty",
+	"/dev/pts",
+}
+
+// systemExecPaths are paths that stay executable when execution is limited
+// They contain the dynamic loader on common distributions
+var systemExecPaths = []string{
+	"/lib",
+	"/lib32",
+	"/lib64",
+	"/libx32",
+	"/usr/lib",
+	"/usr/lib32",
+	"/usr/lib64",
+}
+
+// Landlock access rights used to build rules
+// Execute access is kept separate from read access
+// so that it can be limited to the executable allowlist
+const (
+	accessFSExecute  = landlock.AccessFSSet(ll.AccessFSExecute)
+	accessFSRead     = landlock.AccessFSSet(ll.AccessFSReadFile | ll.AccessFSReadDir)
+	accessFSRefer    = landlock.AccessFSSet(ll.AccessFSRefer)
+	accessFSIoctlDev = landlock.AccessFSSet(ll.AccessFSIoctlDev)
+	accessFSWrite    = landlock.AccessFSSet(ll.AccessFSWriteFile |
+		ll.AccessFSRemoveDir |
+		ll.AccessFSRemoveFile |
+		ll.AccessFSMakeChar |
+		ll.AccessFSMakeDir |
+		ll.AccessFSMakeReg |
+		ll.AccessFSMakeSock |
+		ll.AccessFSMakeFifo |
+		ll.AccessFSMakeBlock |
+		ll.AccessFSMakeSym |
+		ll.AccessFSTruncate)
+
+	// accessFSFile are the access rights that apply to files other than directories
+	accessFSFile = landlock.AccessFSSet(ll.AccessFSExecute |
+		ll.AccessFSReadFile |
+		ll.AccessFSWriteFile |
+		ll.AccessFSTruncate |
+		ll.AccessFSIoctlDev)
 )
 
 // runInSandbox implements sandbox execution for Linux using go-landlock
 func runInSandbox(config *SandboxConfig) error {
 	// If allow-all is set, run without restrictions
 	if config.AllowAll {
+		if config.Supervise {
+			return runInHelper(config)
+		}
+
 		// Find the absolute path of the command
 		path, err := exec.LookPath(config.Command)
 		if err != nil {
@@ -24,61 +112,214 @@ func runInSandbox(config *SandboxConfig) error {
 
 		// Prepare argv: command + args
 		argv := append([]string{config.Command}, config.Args...)
-		return syscall.Exec(path, argv, os.Environ())
+		return syscall.Exec(path, argv, config.Environ())
+	}
+
+	// Find the absolute path of the command
+	path, err := exec.LookPath(config.Command)
+	if err != nil {
+		return fmt.Errorf("command not found: %w", err)
+	}
+
+	// Rules can only be added for existing paths
+	createAllowedPaths(config)
+
+	// Denying network access requires a new network namespace,
+	// a cgroup must be assigned when the process is created,
+	// and the egress proxy and the supervisor must keep running while the command runs,
+	// so the restrictions are applied in a helper process instead
+	if config.Supervise || config.NoNetwork || config.RestrictHosts() || config.UseCgroup {
+		return runInHelper(config)
+	}
+
+	return restrictAndExec(config, path)
+}
+
+// createAllowedPaths creates the allowed paths in CreatePaths that do not exist
+// A path that cannot be created is left out of the rules with a warning
+func createAllowedPaths(config *SandboxConfig) {
+	for _, path := range slices.Sorted(maps.Keys(config.CreatePaths)) {
+		var err error
+		switch config.CreatePaths[path] {
+		case AllowCreateFile:
+			var file *os.File
+			file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+			if err == nil {
+				err = file.Close()
+			}
+		case AllowCreateDirectory:
+			err = os.Mkdir(path, 0o777)
+		}
+		if err != nil && !errors.Is(err, os.ErrExist) {
+			fmt.Fprintf(os.Stderr, "warning: cannot create %s: %v\n", path, err)
+		}
+	}
+}
+
+// restrictAndExec applies Landlock and seccomp restrictions to the current process
+// and replaces it with the command
+func restrictAndExec(config *SandboxConfig, path string) error {
+	// Check which restrictions the kernel can enforce
+	abi, err := checkLandlockABI(config)
+	if err != nil {
+		return err
 	}
 
 	// Build FSRules
 	var rules []landlock.Rule
 
-	// Grant read and execute access to the entire filesystem by default
-	// This allows all file reads and command executions
-	rules = append(rules, landlock.RODirs("/"))
+	// Grant execute access together with read access
+	// unless execution is limited to the executable allowlist
+	readAccess := accessFSRead | accessFSExecute
+	if config.RestrictExec() {
+		readAccess = accessFSRead
+	}
+
+	if config.RestrictReads() {
+		// Grant read access only to the system paths, the command and the specified paths
+		readPaths := slices.Concat(systemReadPaths, []string{path}, config.ReadPaths)
+		rules = appendPathRules(rules, readPaths, readAccess)
+	} else {
+		// Grant read access to the entire filesystem by default
+		// This allows all file reads and, without an executable allowlist, command executions
+		rules = append(rules, landlock.PathAccess(readAccess, "/"))
+	}
+
+	if config.RestrictExec() {
+		// Grant read and execute access to the executable allowlist
+		// The dynamic loader must be executable to start dynamically linked binaries
+		execPaths := slices.Concat(systemExecPaths, config.ExecPaths)
+		if interp, ok := elfInterpreter(path); ok {
+			execPaths = append(execPaths, interp)
+		}
+		rules = appendPathRules(rules, execPaths, accessFSRead|accessFSExecute)
+	}
 
 	// Grant write access to /dev/null by default
 	// Many programs write to /dev/null for discarding output
 	rules = append(rules, landlock.RWFiles("/dev/null"))
 
+	// Renaming and linking files between directories requires Landlock ABI 2
+	// Requesting it on older kernels would disable Landlock entirely
+	referAccess := accessFSRefer
+	if abi < 2 {
+		referAccess = 0
+	}
+
 	// Grant read-write access to specified paths
-	for _, path := range config.AllowedPaths {
-		// Check if the path exists before adding the rule
-		info, err := os.Stat(path)
-		if err != nil {
+	// Execute access is not granted here when execution is limited,
+	// so downloaded binaries in writable paths cannot be run
+	for _, allowedPath := range config.AllowedPaths {
+		if allowedPath == "/dev" || strings.HasPrefix(allowedPath, "/dev/") {
+			rules = appendPathRules(rules, []string{allowedPath}, readAccess|accessFSWrite|accessFSIoctlDev)
 			continue
 		}
-
-		// Use appropriate rule based on file type
-		if info.IsDir() {
-			if path == "/dev" || strings.HasPrefix(path, "/dev/") {
-				rules = append(rules, landlock.RWDirs(path).WithIoctlDev())
-				continue
-			}
-			rules = append(rules, landlock.RWDirs(path).WithRefer())
-		} else {
-			if strings.HasPrefix(path, "/dev/") {
-				rules = append(rules, landlock.RWFiles(path).WithIoctlDev())
-				continue
-			}
-			rules = append(rules, landlock.RWFiles(path))
-		}
+		rules = appendPathRules(rules, []string{allowedPath}, readAccess|accessFSWrite|referAccess)
 	}
 
 	// Apply Landlock restrictions using the best available version
 	// BestEffort ensures graceful degradation on older kernels
-	err := landlock.V5.BestEffort().RestrictPaths(rules...)
-	if err != nil {
+	llConfig := landlock.V6.BestEffort()
+	if config.RestrictNetwork() {
+		// Deny all TCP connect and bind operations except to the allowed ports
+		// Network rules require Landlock V4 or later
+		for _, port := range config.AllowConnect {
+			rules = append(rules, landlock.ConnectTCP(port))
+		}
+		for _, port := range config.AllowBind {
+			rules = append(rules, landlock.BindTCP(port))
+		}
+	} else {
+		llConfig.HandledAccessNet = 0
+	}
+
+	// Only scope the IPC mechanisms that were requested
+	// Scopes require Landlock V6 or later
+	llConfig.Scoped = 0
+	if config.ScopeSignals {
+		llConfig.Scoped |= landlock.ScopedSet(ll.ScopeSignal)
+	}
+	if config.ScopeAbstractSockets {
+		llConfig.Scoped |= landlock.ScopedSet(ll.ScopeAbstractUnixSocket)
+	}
+
+	if err := llConfig.Restrict(rules...); err != nil {
 		return fmt.Errorf("failed to apply Landlock restrictions: %w", err)
 	}
 
-	// Find the absolute path of the command
-	path, err := exec.LookPath(config.Command)
-	if err != nil {
-		return fmt.Errorf("command not found: %w", err)
+	// Resource limits are inherited by the command
+	if err := applyResourceLimits(config.Limits); err != nil {
+		return fmt.Errorf("failed to apply resource limits: %w", err)
+	}
+
+	// Install the seccomp filter just before exec so that it is inherited by the command
+	if err := installSeccompFilter(config); err != nil {
+		if !errors.Is(err, errSeccompUnsupported) || config.Strict {
+			return fmt.Errorf("failed to apply seccomp filter: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "warning: %v; system calls are not filtered\n", err)
+	}
+
+	// Pass file system calls to cage, which asks the user about writes outside the allowed paths
+	// Nothing may be written from here on until cage has received the notification file descriptor
+	if config.Interactive {
+		fd, err := installNotifyFilter()
+		if err != nil {
+			return fmt.Errorf("failed to set up interactive mode: %w", err)
+		}
+		err = sendFD(notifySocketFD, fd)
+		unix.Close(fd)
+		unix.Close(notifySocketFD)
+		if err != nil {
+			return fmt.Errorf("failed to set up interactive mode: %w", err)
+		}
 	}
 
 	// Execute the command with restrictions applied
 	// syscall.Exec replaces the current process
 	argv := append([]string{config.Command}, config.Args...)
-	err = syscall.Exec(path, argv, os.Environ())
+	err = syscall.Exec(path, argv, config.Environ())
 	// If we reach here, exec failed
 	return fmt.Errorf("syscall.Exec failed: %w", err)
 }
+
+// appendPathRules appends rules granting access to the given paths
+// Paths that do not exist are skipped, and access rights that only apply
+// to directories are dropped for other files
+func appendPathRules(rules []landlock.Rule, paths []string, access landlock.AccessFSSet) []landlock.Rule {
+	for _, path := range paths {
+		// Check if the path exists before adding the rule
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		pathAccess := access
+		if !info.IsDir() {
+			pathAccess &= accessFSFile
+		}
+		rules = append(rules, landlock.PathAccess(pathAccess, path))
+	}
+	return rules
+}
+
+// elfInterpreter returns the dynamic loader requested by an ELF executable
+func elfInterpreter(path string) (string, bool) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		interp, err := io.ReadAll(prog.Open())
+		if err != nil {
+			return "", false
+		}
+		return strings.TrimRight(string(interp), "\x00"), true
+	}
+	return "", false
+}
@@ -0,0 +1,339 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"runtime"
+	"slices"
+	"unsafe"
+
+	ll "github.com/landlock-lsm/go-landlock/landlock/syscall"
+	"golang.org/x/sys/unix"
+)
+
+// defaultDeniedSyscalls are denied by the seccomp filter unless allowed by a preset
+// Landlock does not cover these, and they allow a caged process to inspect or
+// affect other processes, the kernel or the mount table
+var defaultDeniedSyscalls = []string{
+	"ptrace",
+	"process_vm_readv",
+	"process_vm_writev",
+	"keyctl",
+	"add_key",
+	"request_key",
+	"bpf",
+	"perf_event_open",
+	"userfaultfd",
+	"io_uring_setup",
+	"io_uring_enter",
+	"io_uring_register",
+	"mount",
+	"umount2",
+	"pivot_root",
+	"fsopen",
+	"fsconfig",
+	"fsmount",
+	"fspick",
+	"move_mount",
+	"open_tree",
+	"mount_setattr",
+	"open_by_handle_at",
+	"kexec_load",
+	"init_module",
+	"finit_module",
+	"delete_module",
+	"swapon",
+	"swapoff",
+	"reboot",
+	"acct",
+}
+
+// syscallNumbers maps the system call names that can be used in presets to their numbers
+var syscallNumbers = map[string]uintptr{
+	"accept4":           unix.SYS_ACCEPT4,
+	"acct":              unix.SYS_ACCT,
+	"add_key":           unix.SYS_ADD_KEY,
+	"adjtimex":          unix.SYS_ADJTIMEX,
+	"bind":              unix.SYS_BIND,
+	"bpf":               unix.SYS_BPF,
+	"chroot":            unix.SYS_CHROOT,
+	"clock_adjtime":     unix.SYS_CLOCK_ADJTIME,
+	"clock_settime":     unix.SYS_CLOCK_SETTIME,
+	"connect":           unix.SYS_CONNECT,
+	"delete_module":     unix.SYS_DELETE_MODULE,
+	"execve":            unix.SYS_EXECVE,
+	"execveat":          unix.SYS_EXECVEAT,
+	"fanotify_init":     unix.SYS_FANOTIFY_INIT,
+	"finit_module":      unix.SYS_FINIT_MODULE,
+	"fsconfig":          unix.SYS_FSCONFIG,
+	"fsmount":           unix.SYS_FSMOUNT,
+	"fsopen":            unix.SYS_FSOPEN,
+	"fspick":            unix.SYS_FSPICK,
+	"init_module":       unix.SYS_INIT_MODULE,
+	"io_uring_enter":    unix.SYS_IO_URING_ENTER,
+	"io_uring_register": unix.SYS_IO_URING_REGISTER,
+	"io_uring_setup":    unix.SYS_IO_URING_SETUP,
+	"kexec_load":        unix.SYS_KEXEC_LOAD,
+	"keyctl":            unix.SYS_KEYCTL,
+	"kill":              unix.SYS_KILL,
+	"listen":            unix.SYS_LISTEN,
+	"lookup_dcookie":    unix.SYS_LOOKUP_DCOOKIE,
+	"mount":             unix.SYS_MOUNT,
+	"mount_setattr":     unix.SYS_MOUNT_SETATTR,
+	"move_mount":        unix.SYS_MOVE_MOUNT,
+	"name_to_handle_at": unix.SYS_NAME_TO_HANDLE_AT,
+	"open_by_handle_at": unix.SYS_OPEN_BY_HANDLE_AT,
+	"open_tree":         unix.SYS_OPEN_TREE,
+	"perf_event_open":   unix.SYS_PERF_EVENT_OPEN,
+	"personality":       unix.SYS_PERSONALITY,
+	"pidfd_getfd":       unix.SYS_PIDFD_GETFD,
+	"pivot_root":        unix.SYS_PIVOT_ROOT,
+	"process_vm_readv":  unix.SYS_PROCESS_VM_READV,
+	"process_vm_writev": unix.SYS_PROCESS_VM_WRITEV,
+	"ptrace":            unix.SYS_PTRACE,
+	"quotactl":          unix.SYS_QUOTACTL,
+	"reboot":            unix.SYS_REBOOT,
+	"request_key":       unix.SYS_REQUEST_KEY,
+	"setns":             unix.SYS_SETNS,
+	"settimeofday":      unix.SYS_SETTIMEOFDAY,
+	"socket":            unix.SYS_SOCKET,
+	"socketpair":        unix.SYS_SOCKETPAIR,
+	"swapoff":           unix.SYS_SWAPOFF,
+	"swapon":            unix.SYS_SWAPON,
+	"syslog":            unix.SYS_SYSLOG,
+	"tgkill":            unix.SYS_TGKILL,
+	"tkill":             unix.SYS_TKILL,
+	"umount2":           unix.SYS_UMOUNT2,
+	"unshare":           unix.SYS_UNSHARE,
+	"userfaultfd":       unix.SYS_USERFAULTFD,
+	"vhangup":           unix.SYS_VHANGUP,
+}
+
+// auditArches maps GOARCH values to the architecture reported to seccomp filters
+var auditArches = map[string]uint32{
+	"386":     unix.AUDIT_ARCH_I386,
+	"amd64":   unix.AUDIT_ARCH_X86_64,
+	"arm":     unix.AUDIT_ARCH_ARM,
+	"arm64":   unix.AUDIT_ARCH_AARCH64,
+	"loong64": unix.AUDIT_ARCH_LOONGARCH64,
+	"ppc64le": unix.AUDIT_ARCH_PPC64LE,
+	"riscv64": unix.AUDIT_ARCH_RISCV64,
+	"s390x":   unix.AUDIT_ARCH_S390X,
+}
+
+// x32SyscallBit marks system calls of the x32 ABI on amd64
+const x32SyscallBit = 0x40000000
+
+// errSeccompUnsupported is returned if seccomp filters cannot be used on this system
+var errSeccompUnsupported = errors.New("seccomp filters are not supported")
+
+// deniedSyscalls returns the system calls denied for the configuration
+// Explicitly denied system calls are denied even if they are also allowed
+func deniedSyscalls(config *SandboxConfig) ([]string, error) {
+	for _, name := range slices.Concat(config.DenySyscalls, config.AllowSyscalls) {
+		if _, ok := syscallNumbers[name]; !ok {
+			return nil, fmt.Errorf(
+				"unknown system call %q (supported: %v)",
+				name,
+				slices.Sorted(maps.Keys(syscallNumbers)),
+			)
+		}
+	}
+
+	var denied []string
+	for _, name := range defaultDeniedSyscalls {
+		if !slices.Contains(config.AllowSyscalls, name) {
+			denied = append(denied, name)
+		}
+	}
+	for _, name := range config.DenySyscalls {
+		if !slices.Contains(denied, name) {
+			denied = append(denied, name)
+		}
+	}
+	return denied, nil
+}
+
+// seccompAction returns the seccomp return value for denied system calls
+func seccompAction(config *SandboxConfig) uint32 {
+	if config.KillOnDeniedSyscall {
+		return unix.SECCOMP_RET_KILL_PROCESS
+	}
+	return unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+}
+
+// buildSeccompFilter builds a BPF program that denies the given system calls
+// System calls of other architectures are denied as well, so that the filter
+// cannot be bypassed through a compatibility ABI
+func buildSeccompFilter(denied []string, action uint32) ([]unix.SockFilter, error) {
+	arch, ok := auditArches[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("%w on %s", errSeccompUnsupported, runtime.GOARCH)
+	}
+	if len(denied) > 255 {
+		return nil, fmt.Errorf("too many denied system calls: %d", len(denied))
+	}
+
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+
+	// struct seccomp_data { int nr; __u32 arch; ... }
+	const offsetNr, offsetArch = 0, 4
+
+	filter := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, arch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, action),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNr),
+	}
+	if runtime.GOARCH == "amd64" {
+		filter = append(filter,
+			jump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, x32SyscallBit, 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, action),
+		)
+	}
+	for i, name := range denied {
+		// Jump over the remaining comparisons and the allow statement
+		skip := uint8(len(denied) - i)
+		filter = append(filter, jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(syscallNumbers[name]), skip, 0))
+	}
+	filter = append(filter,
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+		stmt(unix.BPF_RET|unix.BPF_K, action),
+	)
+	return filter, nil
+}
+
+// installSeccompFilter installs a seccomp filter denying system calls on all threads
+// The filter is inherited across execve and by child processes
+func installSeccompFilter(config *SandboxConfig) error {
+	denied, err := deniedSyscalls(config)
+	if err != nil {
+		return err
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+
+	filter, err := buildSeccompFilter(denied, seccompAction(config))
+	if err != nil {
+		return err
+	}
+
+	// Installing a filter without privileges requires no_new_privs
+	if err := ll.AllThreadsPrctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS): %w", err)
+	}
+
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	tid, _, errno := unix.Syscall(
+		unix.SYS_SECCOMP,
+		unix.SECCOMP_SET_MODE_FILTER,
+		unix.SECCOMP_FILTER_FLAG_TSYNC,
+		uintptr(unsafe.Pointer(&prog)),
+	)
+	runtime.KeepAlive(filter)
+	if errno != 0 {
+		if errno == unix.EINVAL || errno == unix.ENOSYS {
+			return fmt.Errorf("%w: %w", errSeccompUnsupported, errno)
+		}
+		return fmt.Errorf("seccomp(SECCOMP_SET_MODE_FILTER): %w", errno)
+	}
+	if tid != 0 {
+		return fmt.Errorf("seccomp(SECCOMP_SET_MODE_FILTER): failed to synchronize thread %d", tid)
+	}
+	return nil
+}
+
+// buildNotifyFilter builds a BPF program that passes file system calls that may write to files
+// to the user space notifier and allows all other system calls
+// Open system calls are only passed on if their flags request write access
+func buildNotifyFilter() ([]unix.SockFilter, error) {
+	arch, ok := auditArches[runtime.GOARCH]
+	if !ok || len(fileSyscalls) == 0 {
+		return nil, fmt.Errorf("%w on %s", errSeccompUnsupported, runtime.GOARCH)
+	}
+
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+
+	// struct seccomp_data { int nr; __u32 arch; __u64 instruction_pointer; __u64 args[6]; }
+	// The lower half of an argument comes first on little-endian architectures
+	const offsetNr, offsetArch, offsetArgs = 0, 4, 16
+
+	// System calls of other architectures are already denied by the deny filter
+	filter := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, arch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNr),
+	}
+	for _, nr := range slices.Sorted(maps.Keys(fileSyscalls)) {
+		sc := fileSyscalls[nr]
+		if sc.flags < 0 || sc.openHow {
+			filter = append(filter,
+				jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), 0, 1),
+				stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_USER_NOTIF),
+			)
+			continue
+		}
+		filter = append(filter,
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), 0, 4),
+			stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, uint32(offsetArgs+8*sc.flags)),
+			jump(unix.BPF_JMP|unix.BPF_JSET|unix.BPF_K, openWriteFlags, 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_USER_NOTIF),
+			stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW),
+		)
+	}
+	filter = append(filter, stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW))
+	return filter, nil
+}
+
+// installNotifyFilter installs a seccomp filter on all threads that passes file system calls
+// that may write to files to a user space notifier, and returns the notification file descriptor
+// No file may be written after it is installed until the file descriptor is passed to the notifier,
+// because the system call would wait for a response
+func installNotifyFilter() (int, error) {
+	filter, err := buildNotifyFilter()
+	if err != nil {
+		return -1, err
+	}
+
+	// Installing a filter without privileges requires no_new_privs
+	if err := ll.AllThreadsPrctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return -1, fmt.Errorf("prctl(PR_SET_NO_NEW_PRIVS): %w", err)
+	}
+
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	fd, _, errno := unix.Syscall(
+		unix.SYS_SECCOMP,
+		unix.SECCOMP_SET_MODE_FILTER,
+		unix.SECCOMP_FILTER_FLAG_NEW_LISTENER|unix.SECCOMP_FILTER_FLAG_TSYNC|unix.SECCOMP_FILTER_FLAG_TSYNC_ESRCH,
+		uintptr(unsafe.Pointer(&prog)),
+	)
+	runtime.KeepAlive(filter)
+	if errno != 0 {
+		if errno == unix.EINVAL || errno == unix.ENOSYS {
+			return -1, fmt.Errorf("%w: %w", errSeccompUnsupported, errno)
+		}
+		return -1, fmt.Errorf("seccomp(SECCOMP_SET_MODE_FILTER): %w", errno)
+	}
+	return int(fd), nil
+}
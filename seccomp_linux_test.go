@@ -0,0 +1,133 @@
+//go:build linux
+
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestDeniedSyscalls(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     *SandboxConfig
+		wantDeny   []string
+		wantAllow  []string
+		wantErr    bool
+		wantLength int
+	}{
+		{
+			name:       "default denylist",
+			config:     &SandboxConfig{},
+			wantDeny:   []string{"ptrace", "bpf", "io_uring_setup"},
+			wantLength: len(defaultDeniedSyscalls),
+		},
+		{
+			name:       "allow removes from default denylist",
+			config:     &SandboxConfig{AllowSyscalls: []string{"ptrace"}},
+			wantDeny:   []string{"bpf"},
+			wantAllow:  []string{"ptrace"},
+			wantLength: len(defaultDeniedSyscalls) - 1,
+		},
+		{
+			name:       "explicit deny wins over allow",
+			config:     &SandboxConfig{DenySyscalls: []string{"ptrace", "socket"}, AllowSyscalls: []string{"ptrace"}},
+			wantDeny:   []string{"ptrace", "socket"},
+			wantLength: len(defaultDeniedSyscalls) + 1,
+		},
+		{
+			name:    "unknown system call",
+			config:  &SandboxConfig{DenySyscalls: []string{"no_such_syscall"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denied, err := deniedSyscalls(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deniedSyscalls() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(denied) != tt.wantLength {
+				t.Errorf("deniedSyscalls() returned %d system calls, want %d", len(denied), tt.wantLength)
+			}
+			for _, name := range tt.wantDeny {
+				if !slices.Contains(denied, name) {
+					t.Errorf("deniedSyscalls() does not contain %s", name)
+				}
+			}
+			for _, name := range tt.wantAllow {
+				if slices.Contains(denied, name) {
+					t.Errorf("deniedSyscalls() contains %s", name)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildSeccompFilter(t *testing.T) {
+	action := seccompAction(&SandboxConfig{})
+	filter, err := buildSeccompFilter([]string{"ptrace", "bpf"}, action)
+	if err != nil {
+		t.Skipf("seccomp filters are not supported: %v", err)
+	}
+
+	// The last two statements allow everything else and apply the action to denied system calls
+	if got := filter[len(filter)-2]; got.K != unix.SECCOMP_RET_ALLOW {
+		t.Errorf("second to last statement = %+v, want allow", got)
+	}
+	if got := filter[len(filter)-1]; got.K != action {
+		t.Errorf("last statement = %+v, want action %#x", got, action)
+	}
+
+	// Every comparison with a denied system call must jump to the final statement
+	for _, name := range []string{"ptrace", "bpf"} {
+		i := slices.IndexFunc(filter, func(ins unix.SockFilter) bool {
+			return ins.Code == unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K && ins.K == uint32(syscallNumbers[name])
+		})
+		if i < 0 {
+			t.Errorf("no comparison for %s", name)
+			continue
+		}
+		if target := i + 1 + int(filter[i].Jt); target != len(filter)-1 {
+			t.Errorf("comparison for %s jumps to %d, want %d", name, target, len(filter)-1)
+		}
+	}
+}
+
+func TestBuildNotifyFilter(t *testing.T) {
+	filter, err := buildNotifyFilter()
+	if err != nil {
+		t.Skipf("interactive mode is not supported: %v", err)
+	}
+
+	if got := filter[len(filter)-1]; got.K != unix.SECCOMP_RET_ALLOW {
+		t.Errorf("last statement = %+v, want allow", got)
+	}
+
+	// Every file system call must be compared, and open system calls must check the write flags
+	for nr, sc := range fileSyscalls {
+		i := slices.IndexFunc(filter, func(ins unix.SockFilter) bool {
+			return ins.Code == unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K && ins.K == uint32(nr)
+		})
+		if i < 0 {
+			t.Errorf("no comparison for %s", sc.name)
+			continue
+		}
+		next := filter[i+1]
+		if sc.flags >= 0 && !sc.openHow {
+			if next.Code != unix.BPF_LD|unix.BPF_W|unix.BPF_ABS || next.K != uint32(16+8*sc.flags) {
+				t.Errorf("%s: statement after comparison = %+v, want load of the flags", sc.name, next)
+			}
+			continue
+		}
+		if next.K != unix.SECCOMP_RET_USER_NOTIF {
+			t.Errorf("%s: statement after comparison = %+v, want notify", sc.name, next)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runStatus implements the status subcommand
+// It describes the sandbox the current process runs in, using the policy exported by cage
+// and what the kernel reports about the current process
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: cage status [flags]\n")
+		fs.PrintDefaults()
+	}
+	jsonOutput := fs.Bool("json", false, "Print the policy exported by cage as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	policy, err := loadExportedPolicy()
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		if policy == nil {
+			return fmt.Errorf("not running inside cage")
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(policy)
+	}
+
+	printStatus(os.Stdout, policy)
+	fmt.Println()
+	return printKernelStatus(os.Stdout, policy)
+}
+
+// loadExportedPolicy reads the policy from CAGE_POLICY or CAGE_POLICY_FILE
+// It returns nil if neither is set
+func loadExportedPolicy() (*Policy, error) {
+	data := os.Getenv(cagePolicyEnv)
+	if data == "" {
+		path := os.Getenv(cagePolicyFileEnv)
+		if path == "" {
+			return nil, nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", cagePolicyFileEnv, err)
+		}
+		data = string(b)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal([]byte(data), &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// printStatus prints the policy exported by cage
+func printStatus(w io.Writer, policy *Policy) {
+	if policy == nil {
+		if os.Getenv(inCageEnv) == "1" {
+			fmt.Fprintln(w, "Inside cage: yes, but no policy was exported (started by an older version of cage)")
+		} else {
+			fmt.Fprintln(w, "Inside cage: no")
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "Inside cage: yes (depth %d)\n", policy.Depth)
+	if policy.AllowAll {
+		fmt.Fprintln(w, "All restrictions are disabled (-allow-all)")
+		return
+	}
+
+	fmt.Fprintf(w, "Presets: %s\n", joinOrNone(policy.Presets))
+
+	fmt.Fprintln(w, "Writable paths:")
+	fmt.Fprintln(w, "  * /dev/null")
+	for _, path := range policy.Write {
+		fmt.Fprintf(w, "  * %s\n", path)
+	}
+
+	if len(policy.Read) > 0 {
+		fmt.Fprintln(w, "Readable paths (in addition to system paths and writable paths):")
+		for _, path := range policy.Read {
+			fmt.Fprintf(w, "  * %s\n", path)
+		}
+	} else {
+		fmt.Fprintln(w, "Readable paths: all")
+	}
+
+	if len(policy.Exec) > 0 {
+		fmt.Fprintln(w, "Executable paths (in addition to system paths):")
+		for _, path := range policy.Exec {
+			fmt.Fprintf(w, "  * %s\n", path)
+		}
+	} else {
+		fmt.Fprintln(w, "Executable paths: all")
+	}
+
+	fmt.Fprintf(w, "Network: %s\n", describeNetwork(policy.Network))
+
+	var flags []string
+	if policy.Flags.ScopeSignals {
+		flags = append(flags, "scope-signals")
+	}
+	if policy.Flags.ScopeAbstractSockets {
+		flags = append(flags, "scope-abstract-sockets")
+	}
+	if policy.Flags.SafeEnv {
+		flags = append(flags, "safe-env")
+	}
+	if policy.Flags.Cgroup {
+		flags = append(flags, "cgroup")
+	}
+	if policy.Flags.Supervise {
+		flags = append(flags, "supervise")
+	}
+	if policy.Flags.Interactive {
+		flags = append(flags, "interactive")
+	}
+	if policy.Flags.Strict {
+		flags = append(flags, "strict")
+	}
+	if policy.Flags.AllowGit {
+		flags = append(flags, "allow-git")
+	}
+	if policy.Flags.AllowKeychain {
+		flags = append(flags, "allow-keychain")
+	}
+	fmt.Fprintf(w, "Options: %s\n", joinOrNone(flags))
+}
+
+// describeNetwork summarizes the network policy in one line
+func describeNetwork(network PolicyNetwork) string {
+	if network.None {
+		return "loopback only"
+	}
+	if len(network.Connect) == 0 && len(network.Bind) == 0 && len(network.AllowHosts) == 0 {
+		return "all"
+	}
+
+	var parts []string
+	if len(network.AllowHosts) > 0 {
+		parts = append(parts, "HTTP(S) to "+strings.Join(network.AllowHosts, ", ")+" through the built-in proxy")
+	}
+	// With allowed hosts, connections to the proxy are always allowed
+	if len(network.Connect) > 0 || len(network.AllowHosts) == 0 {
+		parts = append(parts, "TCP connect to ports "+joinPorts(network.Connect))
+	}
+	parts = append(parts, "TCP bind to ports "+joinPorts(network.Bind))
+	return strings.Join(parts, "; ")
+}
+
+// joinPorts formats TCP ports as a comma-separated list
+func joinPorts(ports []uint16) string {
+	if len(ports) == 0 {
+		return "(none)"
+	}
+	s := make([]string, len(ports))
+	for i, port := range ports {
+		s[i] = strconv.Itoa(int(port))
+	}
+	return strings.Join(s, ", ")
+}
+
+// joinOrNone joins values with commas, or returns "(none)" if there are none
+func joinOrNone(values []string) string {
+	if len(values) == 0 {
+		return "(none)"
+	}
+	return strings.Join(values, ", ")
+}
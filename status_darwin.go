@@ -0,0 +1,16 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// printKernelStatus prints what is known about the restrictions of the current process
+// macOS does not let a process query its own sandbox profile
+func printKernelStatus(w io.Writer, policy *Policy) error {
+	fmt.Fprintln(w, "Kernel:")
+	fmt.Fprintln(w, "- sandbox-exec: the sandbox profile of a process cannot be queried on macOS")
+	return nil
+}
@@ -0,0 +1,98 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// printKernelStatus prints what the kernel reports about the restrictions of the current process
+// Only no_new_privs and seccomp are read from the kernel; Landlock does not report whether a process
+// is restricted, so the Landlock features are only those declared by the exported policy, which
+// anything inside the sandbox can change
+func printKernelStatus(w io.Writer, policy *Policy) error {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return fmt.Errorf("read process status: %w", err)
+	}
+	defer f.Close()
+	status := parseProcStatus(f)
+
+	abi := landlockABIVersion()
+	fmt.Fprintln(w, "Kernel:")
+	fmt.Fprintf(w, "- no_new_privs (verified): %s\n", yesNo(status["NoNewPrivs"] == "1"))
+	fmt.Fprintf(w, "- seccomp (verified): %s\n", describeSeccomp(status["Seccomp"], status["Seccomp_filters"]))
+	if abi == 0 {
+		fmt.Fprintln(w, "- Landlock: not available")
+		return nil
+	}
+	fmt.Fprintf(w, "- Landlock ABI: %d\n", abi)
+
+	if policy == nil || policy.AllowAll {
+		return nil
+	}
+	// Landlock can only be enforced with no_new_privs set, which cage does before restricting itself
+	if status["NoNewPrivs"] != "1" {
+		fmt.Fprintln(w, "- Landlock features: none (no_new_privs is not set, so this process is not restricted)")
+		return nil
+	}
+	config := &SandboxConfig{
+		AllowedPaths:         policy.Write,
+		AllowConnect:         policy.Network.Connect,
+		AllowBind:            policy.Network.Bind,
+		AllowHosts:           policy.Network.AllowHosts,
+		ScopeSignals:         policy.Flags.ScopeSignals,
+		ScopeAbstractSockets: policy.Flags.ScopeAbstractSockets,
+	}
+	fmt.Fprintln(w, "- Landlock features (declared by the policy, not verified):")
+	for _, feature := range requiredLandlockFeatures(config) {
+		state := "declared"
+		if feature.abi > abi {
+			state = "declared, but not enforced by this kernel"
+		}
+		fmt.Fprintf(w, "  * %s (ABI %d): %s\n", feature.name, feature.abi, state)
+	}
+	return nil
+}
+
+// parseProcStatus parses the "Key:\tvalue" lines of /proc/[pid]/status
+func parseProcStatus(r io.Reader) map[string]string {
+	status := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok {
+			status[key] = strings.TrimSpace(value)
+		}
+	}
+	return status
+}
+
+// describeSeccomp describes the Seccomp and Seccomp_filters fields of /proc/[pid]/status
+func describeSeccomp(mode, filters string) string {
+	switch mode {
+	case "0":
+		return "disabled"
+	case "1":
+		return "strict mode"
+	case "2":
+		if filters != "" {
+			return fmt.Sprintf("filter mode (%s filters)", filters)
+		}
+		return "filter mode"
+	default:
+		return "unknown"
+	}
+}
+
+// yesNo formats a boolean as "yes" or "no"
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
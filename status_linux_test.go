@@ -0,0 +1,48 @@
+//go:build linux
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProcStatus(t *testing.T) {
+	status := parseProcStatus(strings.NewReader(`Name:	cage
+Umask:	0022
+NoNewPrivs:	1
+Seccomp:	2
+Seccomp_filters:	1
+`))
+
+	for key, want := range map[string]string{
+		"Name":            "cage",
+		"NoNewPrivs":      "1",
+		"Seccomp":         "2",
+		"Seccomp_filters": "1",
+	} {
+		if got := status[key]; got != want {
+			t.Errorf("status[%q] = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestDescribeSeccomp(t *testing.T) {
+	tests := []struct {
+		mode    string
+		filters string
+		want    string
+	}{
+		{mode: "0", filters: "0", want: "disabled"},
+		{mode: "1", want: "strict mode"},
+		{mode: "2", filters: "3", want: "filter mode (3 filters)"},
+		{mode: "2", want: "filter mode"},
+		{mode: "", want: "unknown"},
+	}
+
+	for _, tt := range tests {
+		if got := describeSeccomp(tt.mode, tt.filters); got != tt.want {
+			t.Errorf("describeSeccomp(%q, %q) = %q, want %q", tt.mode, tt.filters, got, tt.want)
+		}
+	}
+}
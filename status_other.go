@@ -0,0 +1,16 @@
+//go:build !darwin && !linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// printKernelStatus prints that sandboxing is not supported on this platform
+func printKernelStatus(w io.Writer, policy *Policy) error {
+	fmt.Fprintln(w, "Kernel:")
+	fmt.Fprintf(w, "- sandboxing is not supported on %s\n", runtime.GOOS)
+	return nil
+}
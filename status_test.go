@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadExportedPolicy(t *testing.T) {
+	policyJSON := `{"version":1,"depth":2,"presets":["npm"],"write":["/work"]}`
+	want := &Policy{Version: 1, Depth: 2, Presets: []string{"npm"}, Write: []string{"/work"}}
+
+	t.Run("not inside cage", func(t *testing.T) {
+		t.Setenv(cagePolicyEnv, "")
+		t.Setenv(cagePolicyFileEnv, "")
+		policy, err := loadExportedPolicy()
+		if err != nil || policy != nil {
+			t.Errorf("loadExportedPolicy() = %v, %v, want nil, nil", policy, err)
+		}
+	})
+
+	t.Run("environment variable", func(t *testing.T) {
+		t.Setenv(cagePolicyEnv, policyJSON)
+		t.Setenv(cagePolicyFileEnv, "")
+		policy, err := loadExportedPolicy()
+		if err != nil {
+			t.Fatalf("loadExportedPolicy() error = %v", err)
+		}
+		if !reflect.DeepEqual(policy, want) {
+			t.Errorf("loadExportedPolicy() = %+v, want %+v", policy, want)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "policy.json")
+		os.WriteFile(path, []byte(policyJSON), 0o644)
+		t.Setenv(cagePolicyEnv, "")
+		t.Setenv(cagePolicyFileEnv, path)
+		policy, err := loadExportedPolicy()
+		if err != nil {
+			t.Fatalf("loadExportedPolicy() error = %v", err)
+		}
+		if !reflect.DeepEqual(policy, want) {
+			t.Errorf("loadExportedPolicy() = %+v, want %+v", policy, want)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv(cagePolicyEnv, "{")
+		if _, err := loadExportedPolicy(); err == nil {
+			t.Error("loadExportedPolicy() expected error for invalid JSON")
+		}
+	})
+}
+
+func TestPrintStatus(t *testing.T) {
+	policy := &Policy{
+		Version: 1,
+		Depth:   1,
+		Presets: []string{"npm"},
+		Write:   []string{"/work", "/home/user/.npm"},
+		Network: PolicyNetwork{AllowHosts: []string{"registry.npmjs.org"}},
+		Flags:   PolicyFlags{SafeEnv: true},
+	}
+
+	var buf bytes.Buffer
+	printStatus(&buf, policy)
+
+	want := `Inside cage: yes (depth 1)
+Presets: npm
+Writable paths:
+  * /dev/null
+  * /work
+  * /home/user/.npm
+Readable paths: all
+Executable paths: all
+Network: HTTP(S) to registry.npmjs.org through the built-in proxy; TCP bind to ports (none)
+Options: safe-env
+`
+	if got := buf.String(); got != want {
+		t.Errorf("printStatus() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDescribeNetwork(t *testing.T) {
+	tests := []struct {
+		name    string
+		network PolicyNetwork
+		want    string
+	}{
+		{
+			name:    "unrestricted",
+			network: PolicyNetwork{},
+			want:    "all",
+		},
+		{
+			name:    "none",
+			network: PolicyNetwork{None: true},
+			want:    "loopback only",
+		},
+		{
+			name:    "ports",
+			network: PolicyNetwork{Connect: []uint16{80, 443}},
+			want:    "TCP connect to ports 80, 443; TCP bind to ports (none)",
+		},
+		{
+			name:    "hosts and ports",
+			network: PolicyNetwork{AllowHosts: []string{"example.com"}, Connect: []uint16{22}, Bind: []uint16{3000}},
+			want:    "HTTP(S) to example.com through the built-in proxy; TCP connect to ports 22; TCP bind to ports 3000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeNetwork(tt.network); got != tt.want {
+				t.Errorf("describeNetwork() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
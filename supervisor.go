@@ -0,0 +1,242 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// forwardedSignals are signals that are passed on to the child process
+// SIGINT and SIGQUIT are not forwarded because the terminal already sends them
+// to every process in the foreground process group
+var forwardedSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+// timeoutGracePeriod is how long the command may take to exit after SIGTERM
+// before it is killed with SIGKILL
+const timeoutGracePeriod = 10 * time.Second
+
+// timeoutExitCode is the exit status of cage when the command timed out
+// It is the same as the exit status of timeout(1)
+const timeoutExitCode = 124
+
+// supervisor runs the sandboxed command as a child process of cage
+// It forwards signals to the child, waits for it and runs actions after it exits
+type supervisor struct {
+	cmd        *exec.Cmd
+	afterStart []func() error
+	afterExit  []func(state *os.ProcessState)
+	timeout    time.Duration
+	timedOut   bool
+	// processGroup starts the child in a new process group even without a timeout
+	processGroup bool
+	// killTree kills every process of the command, including processes outside its process group
+	killTree func() error
+}
+
+// newSupervisor returns a supervisor for cmd
+func newSupervisor(cmd *exec.Cmd) *supervisor {
+	return &supervisor{cmd: cmd}
+}
+
+// AfterStart registers f to be called once the child process has started
+// If f returns an error, the child is killed and Run returns the error
+func (s *supervisor) AfterStart(f func() error) {
+	s.afterStart = append(s.afterStart, f)
+}
+
+// AfterExit registers f to be called after the child process has exited
+// Actions run in reverse order of registration, also if the child could not be started,
+// in which case state is nil
+func (s *supervisor) AfterExit(f func(state *os.ProcessState)) {
+	s.afterExit = append(s.afterExit, f)
+}
+
+// SetTimeout terminates the command if it is still running after d
+// The child is started in a new process group so that the whole process tree can be terminated
+func (s *supervisor) SetTimeout(d time.Duration) {
+	s.timeout = d
+}
+
+// SetProcessGroup starts the child in a new process group,
+// which becomes the foreground process group when cage runs in the foreground of a terminal
+func (s *supervisor) SetProcessGroup() {
+	s.processGroup = true
+}
+
+// SetKillTree makes the supervisor call f to kill the command when it times out,
+// in addition to sending SIGKILL to its process group
+// f must kill every process of the command, including processes that moved to another process group or session
+func (s *supervisor) SetKillTree(f func() error) {
+	s.killTree = f
+}
+
+// TimedOut reports whether the command was terminated because of the timeout
+func (s *supervisor) TimedOut() bool {
+	return s.timedOut
+}
+
+// Run starts the child process, forwards signals to it while it runs and waits for it to finish
+// An unsuccessful exit status of the child is not reported as an error
+func (s *supervisor) Run() (state *os.ProcessState, err error) {
+	defer func() {
+		for _, f := range slices.Backward(s.afterExit) {
+			f(state)
+		}
+	}()
+
+	// With its own process group, the child no longer receives signals sent by the terminal
+	// to the process group of cage, so SIGINT and SIGQUIT are forwarded as well
+	processGroup := s.processGroup || s.timeout > 0
+	caught := slices.Concat(forwardedSignals, []os.Signal{syscall.SIGINT, syscall.SIGQUIT})
+	if processGroup && s.setProcessGroup() {
+		defer restoreForeground()
+	}
+
+	// Catch signals before starting the child so that none of them terminate cage
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, caught...)
+	defer signal.Stop(signals)
+
+	if err := s.cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	for _, f := range s.afterStart {
+		if err := f(); err != nil {
+			_ = s.cmd.Process.Kill()
+			_ = s.cmd.Wait()
+			return nil, err
+		}
+	}
+
+	var timeout <-chan time.Time
+	if s.timeout > 0 {
+		timer := time.NewTimer(s.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.cmd.Wait()
+	}()
+
+	var kill <-chan time.Time
+	for {
+		select {
+		case sig := <-signals:
+			if !processGroup && (sig == syscall.SIGINT || sig == syscall.SIGQUIT) {
+				continue
+			}
+			s.signal(sig.(syscall.Signal), processGroup)
+		case <-timeout:
+			s.timedOut = true
+			fmt.Fprintf(os.Stderr, "cage: command timed out after %s; sending SIGTERM\n", s.timeout)
+			s.signal(syscall.SIGTERM, true)
+			killTimer := time.NewTimer(timeoutGracePeriod)
+			defer killTimer.Stop()
+			kill = killTimer.C
+		case <-kill:
+			fmt.Fprintf(os.Stderr, "cage: command did not exit within %s after SIGTERM; sending SIGKILL\n", timeoutGracePeriod)
+			s.kill()
+		case err := <-done:
+			if s.timedOut {
+				// Kill processes left behind in the process group
+				s.kill()
+			}
+			var exitErr *exec.ExitError
+			if err != nil && !errors.As(err, &exitErr) {
+				return nil, fmt.Errorf("wait for command: %w", err)
+			}
+			return s.cmd.ProcessState, nil
+		}
+	}
+}
+
+// setProcessGroup starts the child in a new process group
+// If cage runs in the foreground of a terminal, the new process group becomes the foreground process group
+// so that the command can still read from the terminal and receives the signals sent by it
+// It reports whether the foreground process group is changed
+func (s *supervisor) setProcessGroup() bool {
+	if s.cmd.SysProcAttr == nil {
+		s.cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	s.cmd.SysProcAttr.Setpgid = true
+	if s.cmd.Stdin == os.Stdin && isForeground() {
+		s.cmd.SysProcAttr.Foreground = true
+		s.cmd.SysProcAttr.Ctty = 0
+		return true
+	}
+	return false
+}
+
+// signal sends sig to the child process, or to its process group if group is set
+func (s *supervisor) signal(sig syscall.Signal, group bool) {
+	if group {
+		_ = syscall.Kill(-s.cmd.Process.Pid, sig)
+		return
+	}
+	_ = s.cmd.Process.Signal(sig)
+}
+
+// kill sends SIGKILL to the process group of the child and kills the other processes of the command if possible
+func (s *supervisor) kill() {
+	s.signal(syscall.SIGKILL, true)
+	if s.killTree != nil {
+		if err := s.killTree(); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+		}
+	}
+}
+
+// isForeground reports whether cage is in the foreground process group of the terminal on stdin
+func isForeground() bool {
+	pgrp, err := unix.IoctlGetInt(int(os.Stdin.Fd()), unix.TIOCGPGRP)
+	return err == nil && pgrp == syscall.Getpgrp()
+}
+
+// restoreForeground makes the process group of cage the foreground process group again
+// after the command's process group was moved to the foreground
+func restoreForeground() {
+	fd := int(os.Stdin.Fd())
+	// Changing the foreground process group from the background raises SIGTTOU
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	_ = unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, syscall.Getpgrp())
+}
+
+// exitWithStatus exits the current process with the exit status of a finished child process
+// If the child was killed by a signal, the current process is killed by the same signal
+func exitWithStatus(state *os.ProcessState) {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok {
+		os.Exit(state.ExitCode())
+	}
+	exitWithWaitStatus(status)
+}
+
+// exitWithWaitStatus exits the current process with the given wait status of a child process
+func exitWithWaitStatus(status syscall.WaitStatus) {
+	if status.Signaled() {
+		sig := status.Signal()
+		signal.Reset(sig)
+		_ = syscall.Kill(os.Getpid(), sig)
+		// Fall back to the shell convention if the signal did not terminate cage
+		os.Exit(128 + int(sig))
+	}
+	os.Exit(status.ExitStatus())
+}
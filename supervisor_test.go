@@ -0,0 +1,118 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSupervisorRun(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "exit 3")
+	sv := newSupervisor(cmd)
+
+	var events []string
+	sv.AfterStart(func() error {
+		events = append(events, "started")
+		return nil
+	})
+	sv.AfterExit(func(state *os.ProcessState) {
+		events = append(events, "first registered")
+	})
+	sv.AfterExit(func(state *os.ProcessState) {
+		if state == nil {
+			t.Error("AfterExit got nil state for a command that ran")
+		}
+		events = append(events, "second registered")
+	})
+
+	state, err := sv.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if state.ExitCode() != 3 {
+		t.Errorf("ExitCode() = %d, want 3", state.ExitCode())
+	}
+	want := []string{"started", "second registered", "first registered"}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestSupervisorRunAfterStartError(t *testing.T) {
+	cmd := exec.Command("sleep", "10")
+	sv := newSupervisor(cmd)
+
+	errSetup := errors.New("setup failed")
+	sv.AfterStart(func() error {
+		return errSetup
+	})
+	exited := false
+	sv.AfterExit(func(state *os.ProcessState) {
+		exited = true
+		if state != nil {
+			t.Error("AfterExit got a state although Run failed")
+		}
+	})
+
+	if _, err := sv.Run(); !errors.Is(err, errSetup) {
+		t.Errorf("Run() error = %v, want %v", err, errSetup)
+	}
+	if !exited {
+		t.Error("AfterExit actions did not run")
+	}
+	if cmd.ProcessState == nil || cmd.ProcessState.Success() {
+		t.Error("the command was not killed")
+	}
+}
+
+func TestSupervisorRunStartError(t *testing.T) {
+	cmd := exec.Command("/nonexistent/command")
+	sv := newSupervisor(cmd)
+
+	exited := false
+	sv.AfterExit(func(state *os.ProcessState) {
+		exited = true
+	})
+
+	if _, err := sv.Run(); err == nil {
+		t.Error("Run() expected error for a missing command")
+	}
+	if !exited {
+		t.Error("AfterExit actions did not run")
+	}
+}
+
+func TestSupervisorTimeout(t *testing.T) {
+	// The background sleep must be terminated with the rest of the process group
+	cmd := exec.Command("sh", "-c", "sleep 10 & sleep 10")
+	sv := newSupervisor(cmd)
+	sv.SetTimeout(100 * time.Millisecond)
+
+	start := time.Now()
+	state, err := sv.Run()
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run() took %s, want the command to be terminated after the timeout", elapsed)
+	}
+	if !sv.TimedOut() {
+		t.Error("TimedOut() = false, want true")
+	}
+	if status := state.Sys().(syscall.WaitStatus); !status.Signaled() || status.Signal() != syscall.SIGTERM {
+		t.Errorf("command exited with %v, want it to be terminated by SIGTERM", state)
+	}
+	// Killed processes remain until they are reaped by init
+	for i := 0; syscall.Kill(-cmd.Process.Pid, 0) == nil; i++ {
+		if i == 50 {
+			t.Fatal("processes of the command are still running after the timeout")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A project configuration can allow writes anywhere, so it is only loaded after the user trusted it
+// Trusted files are recorded in the user state directory with the hash of their content,
+// and a file that changed must be trusted again
+
+// Trust states of a project configuration file
+const (
+	trustUnknown = iota
+	trustChanged
+	trustOK
+)
+
+// userStateDir returns the directory for state data of the user
+func userStateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state"), nil
+}
+
+// trustFile returns the file recording the trusted content of the configuration file at path
+func trustFile(path string) (string, error) {
+	stateDir, err := userStateDir()
+	if err != nil {
+		return "", err
+	}
+	abs, err := absPath(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(stateDir, "cage", "trust", hex.EncodeToString(sum[:])), nil
+}
+
+// absPath returns the absolute path of a file with symbolic links resolved,
+// so that a file is trusted however it is reached
+func absPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	return abs, nil
+}
+
+// contentHash returns the hash recorded for trusted content
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checkTrust reports whether the configuration file at path with the content data is trusted
+func checkTrust(path string, data []byte) int {
+	file, err := trustFile(path)
+	if err != nil {
+		return trustUnknown
+	}
+	recorded, err := os.ReadFile(file)
+	if err != nil {
+		return trustUnknown
+	}
+	hash, _, _ := strings.Cut(string(recorded), " ")
+	if hash != contentHash(data) {
+		return trustChanged
+	}
+	return trustOK
+}
+
+// isTrusted reports whether the configuration file at path with the content data is trusted
+func isTrusted(path string, data []byte) bool {
+	return checkTrust(path, data) == trustOK
+}
+
+// trustConfig records the content data of the configuration file at path as trusted
+func trustConfig(path string, data []byte) error {
+	file, err := trustFile(path)
+	if err != nil {
+		return fmt.Errorf("trust %s: %w", path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o700); err != nil {
+		return fmt.Errorf("trust %s: %w", path, err)
+	}
+	abs, _ := absPath(path)
+	// The path is recorded for people looking at the state directory
+	record := contentHash(data) + " " + abs + "\n"
+	if err := os.WriteFile(file, []byte(record), 0o600); err != nil {
+		return fmt.Errorf("trust %s: %w", path, err)
+	}
+	return nil
+}
+
+// untrustConfig removes the trust of the configuration file at path
+func untrustConfig(path string) error {
+	file, err := trustFile(path)
+	if err != nil {
+		return fmt.Errorf("untrust %s: %w", path, err)
+	}
+	if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("untrust %s: %w", path, err)
+	}
+	return nil
+}
+
+// trustedProjectConfig returns the nearest .cage.yaml in the working directory or its parents
+// and the content it was trusted with, if it is trusted
+// The content must be used instead of reading the file again
+// An untrusted file is ignored with a warning
+func trustedProjectConfig() (string, []byte, bool) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", nil, false
+	}
+	path, ok := findProjectConfig(cwd)
+	if !ok {
+		return "", nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring %s: %v\n", path, err)
+		return "", nil, false
+	}
+	switch checkTrust(path, data) {
+	case trustUnknown:
+		fmt.Fprintf(os.Stderr, "warning: ignoring %s because it is not trusted, run 'cage config trust' to use it\n", path)
+		return "", nil, false
+	case trustChanged:
+		fmt.Fprintf(os.Stderr, "warning: ignoring %s because it changed since it was trusted, run 'cage config trust' to use it\n", path)
+		return "", nil, false
+	}
+	return path, data, true
+}
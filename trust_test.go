@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrustConfig(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	path := filepath.Join(t.TempDir(), projectConfigName)
+	data := []byte("presets: {}\n")
+
+	if got := checkTrust(path, data); got != trustUnknown {
+		t.Errorf("checkTrust() before trust = %d, want trustUnknown", got)
+	}
+	if err := trustConfig(path, data); err != nil {
+		t.Fatalf("trustConfig() error = %v", err)
+	}
+	if got := checkTrust(path, data); got != trustOK {
+		t.Errorf("checkTrust() after trust = %d, want trustOK", got)
+	}
+	if got := checkTrust(path, []byte("presets:\n  home:\n    allow: [\"$HOME\"]\n")); got != trustChanged {
+		t.Errorf("checkTrust() of changed content = %d, want trustChanged", got)
+	}
+	if got := checkTrust(filepath.Join(filepath.Dir(path), "other.yaml"), data); got != trustUnknown {
+		t.Errorf("checkTrust() of other file = %d, want trustUnknown", got)
+	}
+	if err := untrustConfig(path); err != nil {
+		t.Fatalf("untrustConfig() error = %v", err)
+	}
+	if got := checkTrust(path, data); got != trustUnknown {
+		t.Errorf("checkTrust() after untrust = %d, want trustUnknown", got)
+	}
+}
+
+func TestTrustedProjectConfig(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(cageConfigEnv, "")
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(sub)
+
+	if _, _, ok := trustedProjectConfig(); ok {
+		t.Error("trustedProjectConfig() found a configuration in an empty directory")
+	}
+
+	path := filepath.Join(root, projectConfigName)
+	data := []byte("presets: {}\n")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := trustedProjectConfig(); ok {
+		t.Error("trustedProjectConfig() returned an untrusted configuration")
+	}
+
+	if err := trustConfig(path, data); err != nil {
+		t.Fatal(err)
+	}
+	got, gotData, ok := trustedProjectConfig()
+	if !ok {
+		t.Fatal("trustedProjectConfig() did not return the trusted configuration")
+	}
+	if resolved, _ := absPath(got); resolved != mustAbsPath(t, path) {
+		t.Errorf("trustedProjectConfig() = %q, want %q", got, path)
+	}
+	if string(gotData) != string(data) {
+		t.Errorf("trustedProjectConfig() data = %q, want %q", gotData, data)
+	}
+
+	// A file changed after its trust was checked is loaded with the content that was checked
+	files := configFiles(nil)
+	if err := os.WriteFile(path, []byte("presets:\n  home:\n    allow: [\"$HOME\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfigFiles(files)
+	if err != nil {
+		t.Fatalf("loadConfigFiles() error = %v", err)
+	}
+	if _, ok := config.GetPreset("home"); ok {
+		t.Error("loadConfigFiles() read the project configuration again after its trust was checked")
+	}
+	if _, _, ok := trustedProjectConfig(); ok {
+		t.Error("trustedProjectConfig() returned a configuration that changed since it was trusted")
+	}
+}
+
+func mustAbsPath(t *testing.T, path string) string {
+	t.Helper()
+	abs, err := absPath(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abs
+}
+
+func TestAddProjectAllowPathsTrust(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	dir := t.TempDir()
+
+	// A new file is created with the approved paths only, so it is trusted
+	created := filepath.Join(dir, "new.yaml")
+	if err := addProjectAllowPaths(created, []AllowPath{{Path: "/tmp"}}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(created)
+	if !isTrusted(created, data) {
+		t.Error("created configuration is not trusted")
+	}
+
+	// The trust is updated when a trusted file is changed
+	if err := addProjectAllowPaths(created, []AllowPath{{Path: "/var/tmp"}}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(created)
+	if !isTrusted(created, data) {
+		t.Error("updated configuration is not trusted")
+	}
+
+	// A file that was not trusted is not trusted by adding paths to it
+	untrusted := filepath.Join(dir, "untrusted.yaml")
+	if err := os.WriteFile(untrusted, []byte("presets:\n  home:\n    allow: [\"$HOME\"]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := addProjectAllowPaths(untrusted, []AllowPath{{Path: "/tmp"}}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(untrusted)
+	if isTrusted(untrusted, data) {
+		t.Error("untrusted configuration became trusted")
+	}
+}
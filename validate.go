@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// configProblem is a problem found in a configuration file
+type configProblem struct {
+	path    string
+	line    int
+	column  int
+	message string
+}
+
+func (p configProblem) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", p.path, p.line, p.column, p.message)
+}
+
+// presetReference is a preset name used in extends or in an auto-preset rule
+type presetReference struct {
+	node ast.Node
+	path string
+	name string
+	// from describes where the reference is used
+	from string
+}
+
+// configValidator checks configuration files strictly
+// Unlike loadConfig, it reports unknown keys, invalid patterns and references to unknown presets
+type configValidator struct {
+	problems   []configProblem
+	references []presetReference
+	// presetKeys are the keys of the presets in the merged configuration
+	presetKeys map[string]ast.Node
+}
+
+// validateConfig checks the configuration files at paths and the configuration merged from them
+// Files that do not exist are skipped
+func validateConfig(paths []string) ([]configProblem, error) {
+	v := &configValidator{presetKeys: map[string]ast.Node{}}
+	merged := &Config{
+		Presets:       make(map[string]Preset),
+		presetOrigins: make(map[string]string),
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if layer := v.validateFile(path, data); layer != nil {
+			merged.merge(layer, path)
+		}
+	}
+
+	// References are checked against the merged configuration, because presets can be defined in another file
+	for _, ref := range v.references {
+		if _, ok := merged.GetPreset(ref.name); !ok {
+			v.add(ref.path, ref.node, "%s references unknown preset '%s'", ref.from, ref.name)
+		}
+	}
+
+	// Unknown presets were reported above, so they are left out when looking for cycles
+	known := &Config{Presets: make(map[string]Preset)}
+	for name, preset := range merged.Presets {
+		preset.Extends = slices.DeleteFunc(slices.Clone(preset.Extends), func(parent string) bool {
+			_, ok := merged.Presets[parent]
+			return !ok
+		})
+		known.Presets[name] = preset
+	}
+	names := known.ListPresets()
+	slices.Sort(names)
+	for _, name := range names {
+		// Each preset in a cycle is reported once, at its own key
+		var cycleErr *presetCycleError
+		_, err := known.ResolvePresets([]string{name})
+		if errors.As(err, &cycleErr) && cycleErr.cycle[0] == name {
+			v.add(merged.presetOrigins[name], v.presetKeys[name], "%v", err)
+		}
+	}
+
+	// Problems are sorted by file and position
+	slices.SortStableFunc(v.problems, func(a, b configProblem) int {
+		if a.path != b.path {
+			return slices.Index(paths, a.path) - slices.Index(paths, b.path)
+		}
+		if a.line != b.line {
+			return a.line - b.line
+		}
+		return a.column - b.column
+	})
+	return v.problems, nil
+}
+
+// add records a problem at the position of node in the file at path
+func (v *configValidator) add(path string, node ast.Node, format string, args ...any) {
+	problem := configProblem{path: path, message: fmt.Sprintf(format, args...)}
+	// The token of a mapping is the first ':', so its first key is reported instead
+	if node != nil && isMapping(node) && len(mappingValues(node)) > 0 {
+		node = mappingValues(node)[0].Key
+	}
+	if node != nil && node.GetToken() != nil {
+		problem.line = node.GetToken().Position.Line
+		problem.column = node.GetToken().Position.Column
+	}
+	v.problems = append(v.problems, problem)
+}
+
+// addError records a decoding error, at the position reported by go-yaml if there is one
+func (v *configValidator) addError(path string, node ast.Node, err error) {
+	var yamlErr yaml.Error
+	if errors.As(err, &yamlErr) && yamlErr.GetToken() != nil {
+		pos := yamlErr.GetToken().Position
+		v.problems = append(v.problems, configProblem{
+			path:    path,
+			line:    pos.Line,
+			column:  pos.Column,
+			message: yamlErr.GetMessage(),
+		})
+		return
+	}
+	v.add(path, node, "%v", err)
+}
+
+// validateFile checks a configuration file and returns the configuration loaded from it,
+// or nil if it cannot be loaded
+// Settings that are invalid are left out, so that the rest of the file can still be checked
+func (v *configValidator) validateFile(path string, data []byte) *Config {
+	file, err := parser.ParseBytes(data, 0)
+	if err != nil {
+		v.addError(path, nil, err)
+		return nil
+	}
+
+	config := &Config{Presets: make(map[string]Preset)}
+	if len(file.Docs) == 0 || file.Docs[0].Body == nil || file.Docs[0].Body.Type() == ast.NullType {
+		return config
+	}
+	body := file.Docs[0].Body
+	if !isMapping(body) {
+		v.add(path, body, "configuration must be a mapping")
+		return nil
+	}
+
+	for _, kv := range mappingValues(body) {
+		switch key := nodeValue(kv.Key); key {
+		case "presets":
+			config.Presets = v.validatePresets(path, kv.Value)
+		case "auto-presets":
+			config.AutoPresets = v.validateAutoPresets(path, kv.Value)
+		default:
+			v.add(path, kv.Key, "unknown field %q", key)
+		}
+	}
+	return config
+}
+
+// validatePresets checks the presets section of a configuration file
+func (v *configValidator) validatePresets(path string, node ast.Node) map[string]Preset {
+	presets := make(map[string]Preset)
+	if node.Type() == ast.NullType {
+		return presets
+	}
+	if !isMapping(node) {
+		v.add(path, node, "presets must be a mapping of preset names to presets")
+		return presets
+	}
+
+	for _, kv := range mappingValues(node) {
+		name := nodeValue(kv.Key)
+		v.presetKeys[name] = kv.Key
+
+		var preset Preset
+		if kv.Value.Type() != ast.NullType && !isMapping(kv.Value) {
+			v.add(path, kv.Value, "preset '%s' must be a mapping", name)
+		} else if v.decodeFields(path, kv.Value, &preset) {
+			if err := preset.Validate(); err != nil {
+				v.add(path, kv.Key, "preset '%s': %v", name, err)
+			}
+		}
+		presets[name] = preset
+
+		for _, field := range mappingValues(kv.Value) {
+			switch nodeValue(field.Key) {
+			case "allow", "read", "exec":
+				v.validateAllowPaths(path, field.Value)
+			case "network":
+				// The options of the network policy are decoded by NetworkPolicy.UnmarshalYAML, which is not strict
+				if isMapping(field.Value) {
+					type networkPolicy NetworkPolicy
+					v.decodeFields(path, field.Value, &networkPolicy{})
+				}
+			case "extends":
+				for _, item := range sequenceValues(field.Value) {
+					v.references = append(v.references, presetReference{
+						node: item,
+						path: path,
+						name: nodeValue(item),
+						from: fmt.Sprintf("preset '%s'", name),
+					})
+				}
+			}
+		}
+	}
+	return presets
+}
+
+// validateAllowPaths checks the entries of an allow, read or exec list
+// Entries are decoded by AllowPath.UnmarshalYAML, which is not strict
+func (v *configValidator) validateAllowPaths(path string, node ast.Node) {
+	for _, item := range sequenceValues(node) {
+		if !isMapping(item) {
+			continue
+		}
+		type allowPath AllowPath
+		var entry allowPath
+		if v.decodeFields(path, item, &entry) && entry.Path == "" {
+			v.add(path, item, "path is required")
+		}
+	}
+}
+
+// validateAutoPresets checks the auto-presets section of a configuration file
+func (v *configValidator) validateAutoPresets(path string, node ast.Node) []AutoPresetRule {
+	if node.Type() == ast.NullType {
+		return nil
+	}
+	if node.Type() != ast.SequenceType {
+		v.add(path, node, "auto-presets must be a list of rules")
+		return nil
+	}
+
+	var rules []AutoPresetRule
+	for _, item := range sequenceValues(node) {
+		if !isMapping(item) {
+			v.add(path, item, "auto-preset rule must be a mapping")
+			continue
+		}
+		var rule AutoPresetRule
+		if !v.decodeFields(path, item, &rule) {
+			continue
+		}
+		if !rule.hasConditions() {
+			v.add(path, item, "auto-preset rule needs a condition")
+		}
+		rules = append(rules, rule)
+
+		for _, field := range mappingValues(item) {
+			switch key := nodeValue(field.Key); key {
+			case "command-pattern", "args-pattern", "cwd-pattern":
+				if _, err := regexp.Compile(nodeValue(field.Value)); err != nil {
+					v.add(path, field.Value, "invalid %s: %v", key, err)
+				}
+			case "when-file":
+				if _, err := filepath.Match(nodeValue(field.Value), ""); err != nil {
+					v.add(path, field.Value, "invalid when-file: %v", err)
+				}
+			case "env":
+				for _, env := range mappingValues(field.Value) {
+					if _, err := matchEnvValue(nodeValue(env.Value), ""); err != nil {
+						v.add(path, env.Value, "invalid env pattern: %v", err)
+					}
+				}
+			case "presets", "exclude-presets":
+				for _, preset := range sequenceValues(field.Value) {
+					v.references = append(v.references, presetReference{
+						node: preset,
+						path: path,
+						name: nodeValue(preset),
+						from: "auto-preset rule",
+					})
+				}
+			}
+		}
+	}
+	return rules
+}
+
+// decodeFields decodes the fields of a mapping into out one by one with unknown fields disallowed,
+// so that every invalid field is reported
+// It reports whether all fields were decoded
+func (v *configValidator) decodeFields(path string, node ast.Node, out any) bool {
+	ok := true
+	for _, field := range mappingValues(node) {
+		if err := yaml.NodeToValue(field, out, yaml.Strict()); err != nil {
+			v.addError(path, field, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// sequenceValues returns the items of a sequence node
+func sequenceValues(node ast.Node) []ast.Node {
+	if seq, ok := node.(*ast.SequenceNode); ok {
+		return seq.Values
+	}
+	return nil
+}
+
+// isMapping reports whether node is a mapping
+func isMapping(node ast.Node) bool {
+	return node.Type() == ast.MappingType || node.Type() == ast.MappingValueType
+}
+
+// nodeValue returns the value of a scalar node without quotes
+func nodeValue(node ast.Node) string {
+	if node.GetToken() == nil {
+		return node.String()
+	}
+	return node.GetToken().Value
+}
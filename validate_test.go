@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "valid config",
+			content: `presets:
+  base:
+    allow:
+      - "."
+      - path: /tmp
+        eval-symlinks: true
+  npm:
+    extends: [base]
+    network:
+      allow-hosts: [registry.npmjs.org]
+auto-presets:
+  - command-pattern: ^(npm|npx)$
+    presets: [npm]`,
+		},
+		{
+			name:    "empty file",
+			content: "",
+		},
+		{
+			name: "unknown keys",
+			content: `presets:
+  npm:
+    allow_git: true
+    allow:
+      - path: /tmp
+        eval_symlinks: true
+    network:
+      allow-host: [example.com]
+auto-preset:
+  - command: npm
+    presets: [npm]`,
+			want: []string{
+				`test.yaml:3:5: unknown field "allow_git"`,
+				`test.yaml:6:9: unknown field "eval_symlinks"`,
+				`test.yaml:8:7: unknown field "allow-host"`,
+				`test.yaml:9:1: unknown field "auto-preset"`,
+			},
+		},
+		{
+			name: "invalid values",
+			content: `presets:
+  npm:
+    timeout: -1s
+  ports:
+    connect: [70000]`,
+			want: []string{
+				`test.yaml:2:3: preset 'npm': invalid timeout -1s: must not be negative`,
+				`test.yaml:5:15: cannot unmarshal 70000 into Go value of type uint16 ( overflow )`,
+			},
+		},
+		{
+			name: "auto-preset rules",
+			content: `presets:
+  npm: {}
+auto-presets:
+  - command-pattern: "[npm"
+    presets: [npm, missing]
+  - presets: [npm]
+  - command: npm
+    args-pattern: (publish
+    env:
+      CI: "[true"
+    exclude-presets: [npx]
+  - when-file: "[Cargo.toml"
+    presets: [npm]`,
+			want: []string{
+				`test.yaml:4:22: invalid command-pattern: error parsing regexp: missing closing ]: ` + "`[npm`",
+				`test.yaml:5:20: auto-preset rule references unknown preset 'missing'`,
+				`test.yaml:6:5: auto-preset rule needs a condition`,
+				`test.yaml:8:19: invalid args-pattern: error parsing regexp: missing closing ): ` + "`(publish`",
+				`test.yaml:10:11: invalid env pattern: syntax error in pattern`,
+				`test.yaml:11:23: auto-preset rule references unknown preset 'npx'`,
+				`test.yaml:12:16: invalid when-file: syntax error in pattern`,
+			},
+		},
+		{
+			name: "extends",
+			content: `presets:
+  a:
+    extends: [b]
+  b:
+    extends: [a, missing]`,
+			want: []string{
+				`test.yaml:2:3: preset 'a' extends itself: a -> b -> a`,
+				`test.yaml:4:3: preset 'b' extends itself: b -> a -> b`,
+				`test.yaml:5:18: preset 'b' references unknown preset 'missing'`,
+			},
+		},
+		{
+			name:    "syntax error",
+			content: "presets:\n  npm: [\n",
+			want:    []string{`test.yaml:2:8: sequence end token ']' not found`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			os.WriteFile("test.yaml", []byte(tt.content), 0o644)
+
+			problems, err := validateConfig([]string{"test.yaml"})
+			if err != nil {
+				t.Fatalf("validateConfig() error = %v", err)
+			}
+			var got []string
+			for _, problem := range problems {
+				got = append(got, problem.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validateConfig() =\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateConfigAcrossFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	userPath := filepath.Join(tmpDir, "user.yaml")
+	os.WriteFile(userPath, []byte("presets:\n  npm:\n    allow: [\"$HOME/.npm\"]\n"), 0o644)
+	projectPath := filepath.Join(tmpDir, "project.yaml")
+	os.WriteFile(projectPath, []byte("presets:\n  build:\n    extends: [npm]\nauto-presets:\n  - command: make\n    presets: [build]\n"), 0o644)
+
+	// Presets can be referenced from another file
+	problems, err := validateConfig([]string{userPath, filepath.Join(tmpDir, "missing.yaml"), projectPath})
+	if err != nil {
+		t.Fatalf("validateConfig() error = %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("validateConfig() = %v, want no problems", problems)
+	}
+
+	problems, err = validateConfig([]string{projectPath})
+	if err != nil {
+		t.Fatalf("validateConfig() error = %v", err)
+	}
+	want := []configProblem{{path: projectPath, line: 3, column: 15, message: "preset 'build' references unknown preset 'npm'"}}
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("validateConfig() = %v, want %v", problems, want)
+	}
+}